@@ -0,0 +1,227 @@
+package mantil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+var awsConfigOverride struct {
+	sync.Mutex
+	cfg *aws.Config
+	// default config loaded from the environment
+	loaded *aws.Config
+}
+
+// awsClients are AWS clients shared by all helpers in the process, created
+// on the first use.
+var awsClients struct {
+	sync.Mutex
+	dynamo  *dynamo
+	s3      *s3
+	kms     *kms.Client
+	sqs     *sqs
+	sns     *sns
+	ssm     *ssm
+	secrets *secretsmanager.Client
+	tagging *resourcegroupstaggingapi.Client
+	lambdas map[string]*lambda.Client
+	// verified resources, checked and created once per process
+	verified map[string]struct{}
+}
+
+// SetAWSConfig sets config used by all AWS clients created in mantil.go,
+// instead of the default config loaded from the environment. Use it to set
+// region, credentials or EndpointResolver, e.g. to connect to the local
+// stand-ins of the AWS services in tests.
+// Shared clients are recreated with the new config, existing KV, tables and
+// buckets keep using the clients created before the call.
+//
+// Endpoints of the single services can also be set with the environment
+// variables MANTIL_DYNAMODB_ENDPOINT, MANTIL_S3_ENDPOINT,
+// MANTIL_LAMBDA_ENDPOINT, MANTIL_KMS_ENDPOINT, MANTIL_STS_ENDPOINT,
+// MANTIL_SQS_ENDPOINT, MANTIL_SNS_ENDPOINT, MANTIL_SSM_ENDPOINT,
+// MANTIL_SECRETSMANAGER_ENDPOINT and MANTIL_TAGGING_ENDPOINT.
+// S3 client uses path style addressing when the endpoint is set, as
+// required by MinIO.
+// Example:
+//   // DynamoDB Local
+//   os.Setenv("MANTIL_DYNAMODB_ENDPOINT", "http://localhost:8000")
+//
+//   // or for all services, LocalStack
+//   mantil.SetAWSConfig(aws.Config{
+//   	Region:      "us-east-1",
+//   	Credentials: credentials.NewStaticCredentialsProvider("test", "test", ""),
+//   	EndpointResolver: aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
+//   		return aws.Endpoint{URL: "http://localhost:4566", HostnameImmutable: true}, nil
+//   	}),
+//   })
+//
+func SetAWSConfig(cfg aws.Config) {
+	awsConfigOverride.Lock()
+	awsConfigOverride.cfg = &cfg
+	awsConfigOverride.Unlock()
+	// client constructors hold awsClients while loading config, so it is
+	// locked only after releasing awsConfigOverride
+	resetAWSClients()
+}
+
+// resetAWSClients removes shared clients and verified resources.
+func resetAWSClients() {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	awsClients.dynamo = nil
+	awsClients.s3 = nil
+	awsClients.kms = nil
+	awsClients.sqs = nil
+	awsClients.sns = nil
+	awsClients.ssm = nil
+	awsClients.secrets = nil
+	awsClients.tagging = nil
+	awsClients.lambdas = nil
+	awsClients.verified = nil
+}
+
+// isVerified reports whether the resource is already checked in the process.
+func isVerified(resource string) bool {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	_, ok := awsClients.verified[resource]
+	return ok
+}
+
+// setVerified remembers that the resource exists with the required settings.
+func setVerified(resource string) {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	if awsClients.verified == nil {
+		awsClients.verified = make(map[string]struct{})
+	}
+	awsClients.verified[resource] = struct{}{}
+}
+
+// clearVerified forgets verified resources, after they are destroyed.
+func clearVerified() {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	awsClients.verified = nil
+	if awsClients.sqs != nil {
+		awsClients.sqs.mu.Lock()
+		awsClients.sqs.urls = nil
+		awsClients.sqs.mu.Unlock()
+	}
+	if awsClients.sns != nil {
+		awsClients.sns.mu.Lock()
+		awsClients.sns.topics = nil
+		awsClients.sns.mu.Unlock()
+	}
+}
+
+// kmsClient returns shared KMS client.
+func kmsClient() (*kms.Client, error) {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	if awsClients.kms != nil {
+		return awsClients.kms, nil
+	}
+	cfg, err := loadAWSConfig(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	awsClients.kms = kms.NewFromConfig(cfg, func(o *kms.Options) {
+		if ep := awsEndpoint(EnvKMSEndpoint); ep != "" {
+			o.EndpointResolver = kms.EndpointResolverFromURL(ep)
+		}
+	})
+	return awsClients.kms, nil
+}
+
+// secretsManagerClient returns shared Secrets Manager client.
+func secretsManagerClient() (*secretsmanager.Client, error) {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	if awsClients.secrets != nil {
+		return awsClients.secrets, nil
+	}
+	cfg, err := loadAWSConfig(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	awsClients.secrets = secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+		if ep := awsEndpoint(EnvSecretsManagerEndpoint); ep != "" {
+			o.EndpointResolver = secretsmanager.EndpointResolverFromURL(ep)
+		}
+	})
+	return awsClients.secrets, nil
+}
+
+// taggingClient returns shared Resource Groups Tagging API client.
+func taggingClient() (*resourcegroupstaggingapi.Client, error) {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	if awsClients.tagging != nil {
+		return awsClients.tagging, nil
+	}
+	cfg, err := loadAWSConfig(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	awsClients.tagging = resourcegroupstaggingapi.NewFromConfig(cfg, func(o *resourcegroupstaggingapi.Options) {
+		if ep := awsEndpoint(EnvTaggingEndpoint); ep != "" {
+			o.EndpointResolver = resourcegroupstaggingapi.EndpointResolverFromURL(ep)
+		}
+	})
+	return awsClients.tagging, nil
+}
+
+// lambdaClient returns shared Lambda client for the region and role.
+func lambdaClient(key string, create func() *lambda.Client) *lambda.Client {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	if c, ok := awsClients.lambdas[key]; ok {
+		return c
+	}
+	c := create()
+	if awsClients.lambdas == nil {
+		awsClients.lambdas = make(map[string]*lambda.Client)
+	}
+	awsClients.lambdas[key] = c
+	return c
+}
+
+// loadAWSConfig returns config set by SetAWSConfig, or loads default config
+// from the environment variables, shared credentials, and shared
+// configuration files. Default config is loaded once per process, options
+// are used only when loading default config and then it is not remembered.
+func loadAWSConfig(ctx context.Context, optFns ...func(*awsConfig.LoadOptions) error) (aws.Config, error) {
+	awsConfigOverride.Lock()
+	defer awsConfigOverride.Unlock()
+	if c := awsConfigOverride.cfg; c != nil {
+		return c.Copy(), nil
+	}
+	if c := awsConfigOverride.loaded; c != nil && len(optFns) == 0 {
+		return c.Copy(), nil
+	}
+	cfg, err := awsConfig.LoadDefaultConfig(ctx, optFns...)
+	if err != nil {
+		return cfg, fmt.Errorf("unable to load SDK config, %w", err)
+	}
+	if len(optFns) == 0 {
+		awsConfigOverride.loaded = &cfg
+	}
+	return cfg.Copy(), nil
+}
+
+// awsEndpoint returns service endpoint from the environment variable, empty
+// if not set.
+func awsEndpoint(envVarName string) string {
+	return os.Getenv(envVarName)
+}
@@ -0,0 +1,180 @@
+package mantil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetAWSConfig(t *testing.T) {
+	defer func() {
+		awsConfigOverride.cfg = nil
+		resetAWSClients()
+	}()
+	SetAWSConfig(aws.Config{
+		Region:      "local",
+		Credentials: credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+	cfg, err := loadAWSConfig(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "local", cfg.Region)
+
+	t.Setenv(EnvS3Endpoint, "http://localhost:9000/")
+	s, err := newS3()
+	require.NoError(t, err)
+	require.Equal(t, "local", s.region)
+
+	b := &Bucket{name: "bucket", s3: s}
+	post, err := b.PresignPost("key", PresignOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:9000/bucket/", post.URL)
+	require.Contains(t, post.Fields["x-amz-credential"], "key/")
+
+	req, err := b.PresignGet("key", PresignOptions{})
+	require.NoError(t, err)
+	require.Contains(t, req.URL, "http://localhost:9000/bucket/key?")
+
+	// endpoint resolver set in the config
+	os.Unsetenv(EnvS3Endpoint)
+	SetAWSConfig(aws.Config{
+		Region:      "local",
+		Credentials: credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		EndpointResolver: aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: "http://localhost:4566", HostnameImmutable: true}, nil
+		}),
+	})
+	s, err = newS3()
+	require.NoError(t, err)
+	b = &Bucket{name: "bucket", s3: s}
+	post, err = b.PresignPost("key", PresignOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:4566/bucket/", post.URL)
+}
+
+// run with -race
+func TestSetAWSConfigConcurrent(t *testing.T) {
+	defer func() {
+		awsConfigOverride.cfg = nil
+		resetAWSClients()
+	}()
+	cfg := aws.Config{
+		Region:      "local",
+		Credentials: credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	}
+	SetAWSConfig(cfg)
+
+	const n = 50
+	errs := make(chan error, n)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				SetAWSConfig(cfg)
+			}()
+			go func() {
+				defer wg.Done()
+				_, err := newDynamo()
+				errs <- err
+			}()
+		}
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("SetAWSConfig and newDynamo not finished")
+	}
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+func TestSetAWSConfigLockOrder(t *testing.T) {
+	defer func() {
+		awsConfigOverride.cfg = nil
+		resetAWSClients()
+	}()
+	SetAWSConfig(aws.Config{Region: "old"})
+
+	// client constructor holds awsClients while loading config
+	awsClients.Lock()
+	set := make(chan struct{})
+	go func() {
+		defer close(set)
+		SetAWSConfig(aws.Config{Region: "new"})
+	}()
+	loaded := make(chan struct{})
+	go func() {
+		defer close(loaded)
+		for {
+			cfg, err := loadAWSConfig(context.Background())
+			if err != nil || cfg.Region == "new" {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-loaded:
+	case <-time.After(5 * time.Second):
+		t.Error("SetAWSConfig holds config lock while waiting for clients lock")
+	}
+	// releasing clients lock resolves the deadlock in any case
+	awsClients.Unlock()
+	<-set
+	<-loaded
+}
+
+func TestSharedAWSClients(t *testing.T) {
+	defer func() {
+		awsConfigOverride.cfg = nil
+		resetAWSClients()
+	}()
+	SetAWSConfig(aws.Config{
+		Region:      "local",
+		Credentials: credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		Retryer:     func() aws.Retryer { return aws.NopRetryer{} },
+	})
+	// nothing listens on the endpoint, any request fails
+	t.Setenv(EnvDynamodbEndpoint, "http://127.0.0.1:1")
+
+	d1, err := newDynamo()
+	require.NoError(t, err)
+	d2, err := newDynamo()
+	require.NoError(t, err)
+	require.True(t, d1 == d2)
+
+	s1, err := newS3()
+	require.NoError(t, err)
+	s2, err := newS3()
+	require.NoError(t, err)
+	require.True(t, s1 == s2)
+
+	opts := TableOptions{PartitionKey: TableKey{Name: pk}}
+	require.Error(t, d1.ensureTable("table", opts))
+	// verified table is not checked again
+	setVerified("table/table/" + fmt.Sprintf("%v", opts))
+	require.NoError(t, d1.ensureTable("table", opts))
+	// but is for the different options
+	opts.TTLAttribute = "expires"
+	require.Error(t, d1.ensureTable("table", opts))
+
+	// new config creates new clients and forgets verified resources
+	SetAWSConfig(aws.Config{Region: "local"})
+	d3, err := newDynamo()
+	require.NoError(t, err)
+	require.False(t, d1 == d3)
+	require.False(t, isVerified("table/table/"+fmt.Sprintf("%v", TableOptions{PartitionKey: TableKey{Name: pk}})))
+}
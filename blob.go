@@ -0,0 +1,73 @@
+package mantil
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BlobStore is a simple object store. Objects are identified by the keys,
+// slash separated paths like "images/1.png".
+type BlobStore interface {
+	// Put stores content of the reader under the key with the metadata,
+	// replacing existing object.
+	Put(key string, r io.Reader, meta map[string]string) error
+	// Get returns object, caller must close it.
+	// Returns ErrBlobNotFound if the object doesn't exist.
+	Get(key string) (*Blob, error)
+	// List returns info of the objects with the key prefix ordered by key.
+	// Meta is not filled in the listed info.
+	List(prefix string) ([]BlobInfo, error)
+	// Delete removes object, deleting non existing object is not an error.
+	Delete(key string) error
+	// Exists checks if the object exists.
+	Exists(key string) (bool, error)
+}
+
+// BlobInfo describes object in the BlobStore.
+type BlobInfo struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+	Meta     map[string]string
+}
+
+// Blob is an object read from the BlobStore.
+type Blob struct {
+	io.ReadCloser
+	BlobInfo
+}
+
+// ErrBlobNotFound is returned when object with that key is not found in blob store.
+type ErrBlobNotFound struct {
+	key string
+}
+
+func (e ErrBlobNotFound) Error() string {
+	return fmt.Sprintf("blob with key: %s not found", e.key)
+}
+
+// NewBlobStore returns BlobStore backed by the project S3 bucket, see
+// NewBucket.
+//
+// If the MANTIL_BLOB_DIR environment variable is set store uses local
+// filesystem directory name in that dir instead, for tests and offline
+// development.
+// Example:
+//   store, err := mantil.NewBlobStore("reports")
+//   err = store.Put("2021/10/report.csv", r, map[string]string{"owner": "ops"})
+//   blob, err := store.Get("2021/10/report.csv")
+//   defer blob.Close()
+//
+func NewBlobStore(name string) (BlobStore, error) {
+	if dir, ok := os.LookupEnv(EnvBlobDir); ok && dir != "" {
+		return NewFSBlobStore(filepath.Join(dir, name))
+	}
+	b, err := NewBucket(name)
+	if err != nil {
+		return nil, err
+	}
+	return &s3BlobStore{bucket: b}, nil
+}
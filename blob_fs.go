@@ -0,0 +1,193 @@
+package mantil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// directory in the store root with the objects metadata
+const fsBlobMetaDir = ".meta"
+
+// fsBlobStore is BlobStore in the local filesystem directory.
+type fsBlobStore struct {
+	dir string
+}
+
+// NewFSBlobStore returns BlobStore which keeps objects as files in the
+// directory. Directory is created if it doesn't exist. Object metadata is
+// stored in the .meta subdirectory.
+func NewFSBlobStore(dir string) (BlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fsBlobStore{dir: dir}, nil
+}
+
+// path returns file path of the object key.
+func (s *fsBlobStore) path(key string) (string, error) {
+	k := filepath.FromSlash(key)
+	if key == "" || filepath.IsAbs(k) || filepath.Clean(k) != k ||
+		strings.HasPrefix(k, "..") || strings.HasPrefix(k, fsBlobMetaDir) {
+		return "", fmt.Errorf("invalid blob key %s", key)
+	}
+	return filepath.Join(s.dir, k), nil
+}
+
+func (s *fsBlobStore) metaPath(key string) string {
+	return filepath.Join(s.dir, fsBlobMetaDir, filepath.FromSlash(key)+".json")
+}
+
+func (s *fsBlobStore) Put(key string, r io.Reader, meta map[string]string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// write to the temporary file so the readers never see partial object
+	f, err := ioutil.TempFile(filepath.Dir(path), ".blob-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := s.putMeta(key, meta); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s *fsBlobStore) putMeta(key string, meta map[string]string) error {
+	path := s.metaPath(key)
+	if len(meta) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	buf, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf, 0644)
+}
+
+func (s *fsBlobStore) Get(key string) (*Blob, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &ErrBlobNotFound{key: key}
+		}
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		f.Close()
+		return nil, &ErrBlobNotFound{key: key}
+	}
+	b := &Blob{
+		ReadCloser: f,
+		BlobInfo: BlobInfo{
+			Key:      key,
+			Size:     fi.Size(),
+			Modified: fi.ModTime(),
+		},
+	}
+	if buf, err := ioutil.ReadFile(s.metaPath(key)); err == nil {
+		if err := json.Unmarshal(buf, &b.Meta); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (s *fsBlobStore) List(prefix string) ([]BlobInfo, error) {
+	var infos []BlobInfo
+	err := filepath.Walk(s.dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if rel == fsBlobMetaDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(fi.Name(), ".blob-") {
+			return nil
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		infos = append(infos, BlobInfo{
+			Key:      key,
+			Size:     fi.Size(),
+			Modified: fi.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
+
+func (s *fsBlobStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(s.metaPath(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *fsBlobStore) Exists(key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return !fi.IsDir(), nil
+}
@@ -0,0 +1,99 @@
+package mantil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3svc "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// s3BlobStore is BlobStore in the project bucket.
+type s3BlobStore struct {
+	bucket *Bucket
+}
+
+func (s *s3BlobStore) Put(key string, r io.Reader, meta map[string]string) error {
+	w := s.bucket.Writer(key, "")
+	w.meta = meta
+	if _, err := io.Copy(w, r); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *s3BlobStore) Get(key string) (*Blob, error) {
+	out, err := s.bucket.s3.client.GetObject(context.Background(), &s3svc.GetObjectInput{
+		Bucket: aws.String(s.bucket.name),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var nsk *types.NoSuchKey
+		if errors.As(err, &nsk) {
+			return nil, &ErrBlobNotFound{key: key}
+		}
+		return nil, fmt.Errorf("could not get blob %s - %w", key, err)
+	}
+	return &Blob{
+		ReadCloser: out.Body,
+		BlobInfo: BlobInfo{
+			Key:      key,
+			Size:     out.ContentLength,
+			Modified: aws.ToTime(out.LastModified),
+			Meta:     out.Metadata,
+		},
+	}, nil
+}
+
+func (s *s3BlobStore) List(prefix string) ([]BlobInfo, error) {
+	var infos []BlobInfo
+	p := s3svc.NewListObjectsV2Paginator(s.bucket.s3.client, &s3svc.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket.name),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("could not list blobs %s - %w", prefix, err)
+		}
+		for _, o := range out.Contents {
+			infos = append(infos, BlobInfo{
+				Key:      aws.ToString(o.Key),
+				Size:     o.Size,
+				Modified: aws.ToTime(o.LastModified),
+			})
+		}
+	}
+	return infos, nil
+}
+
+func (s *s3BlobStore) Delete(key string) error {
+	_, err := s.bucket.s3.client.DeleteObject(context.Background(), &s3svc.DeleteObjectInput{
+		Bucket: aws.String(s.bucket.name),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("could not delete blob %s - %w", key, err)
+	}
+	return nil
+}
+
+func (s *s3BlobStore) Exists(key string) (bool, error) {
+	_, err := s.bucket.s3.client.HeadObject(context.Background(), &s3svc.HeadObjectInput{
+		Bucket: aws.String(s.bucket.name),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var oe smithy.APIError
+		if errors.As(err, &oe) && oe.ErrorCode() == "NotFound" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,97 @@
+package mantil
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3svc "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func testBlobStore(t *testing.T, s BlobStore) {
+	ok, err := s.Exists("a/1.txt")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = s.Get("a/1.txt")
+	var nf *ErrBlobNotFound
+	require.True(t, errors.As(err, &nf))
+
+	require.NoError(t, s.Put("a/1.txt", strings.NewReader("one"), map[string]string{"owner": "ops"}))
+	require.NoError(t, s.Put("a/2.txt", strings.NewReader("two"), nil))
+	require.NoError(t, s.Put("b/1.txt", strings.NewReader("three"), nil))
+
+	ok, err = s.Exists("a/1.txt")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	b, err := s.Get("a/1.txt")
+	require.NoError(t, err)
+	buf, err := ioutil.ReadAll(b)
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+	require.Equal(t, "one", string(buf))
+	require.Equal(t, int64(3), b.Size)
+	require.Equal(t, "ops", b.Meta["owner"])
+
+	// replace removes metadata
+	require.NoError(t, s.Put("a/1.txt", strings.NewReader("four"), nil))
+	b, err = s.Get("a/1.txt")
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+	require.Equal(t, int64(4), b.Size)
+	require.Empty(t, b.Meta)
+
+	infos, err := s.List("a/")
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	require.Equal(t, "a/1.txt", infos[0].Key)
+	require.Equal(t, "a/2.txt", infos[1].Key)
+	infos, err = s.List("")
+	require.NoError(t, err)
+	require.Len(t, infos, 3)
+
+	for _, key := range []string{"a/1.txt", "a/2.txt", "b/1.txt"} {
+		require.NoError(t, s.Delete(key))
+	}
+	require.NoError(t, s.Delete("a/1.txt"))
+	infos, err = s.List("")
+	require.NoError(t, err)
+	require.Len(t, infos, 0)
+}
+
+func TestFSBlobStore(t *testing.T) {
+	s, err := NewFSBlobStore(t.TempDir())
+	require.NoError(t, err)
+	testBlobStore(t, s)
+
+	for _, key := range []string{"", "/etc/passwd", "../x", "a/../../x", ".meta/a"} {
+		require.Error(t, s.Put(key, strings.NewReader(""), nil), key)
+	}
+}
+
+func TestNewBlobStoreDir(t *testing.T) {
+	t.Setenv(EnvBlobDir, t.TempDir())
+	s, err := NewBlobStore("blobs")
+	require.NoError(t, err)
+	_, ok := s.(*fsBlobStore)
+	require.True(t, ok)
+	testBlobStore(t, s)
+}
+
+func TestS3BlobStore(t *testing.T) {
+	s, err := NewBlobStore("my-blob-store")
+	require.NoError(t, err)
+	testBlobStore(t, s)
+
+	// cleanup
+	b := s.(*s3BlobStore).bucket
+	_, err = b.Client().DeleteBucket(context.Background(), &s3svc.DeleteBucketInput{
+		Bucket: aws.String(b.Name()),
+	})
+	require.NoError(t, err)
+}
@@ -197,6 +197,17 @@ func (c *caller) call(ctx context.Context, reqPayload []byte, reqParams map[stri
 	)
 }
 
+// hasMethod checks if the api has method, names are matched as in call.
+func (c *caller) hasMethod(methodName string) bool {
+	methodName = strings.Replace(strings.ToLower(methodName), "-", "", -1)
+	for i := 0; i < c.typ.NumMethod(); i++ {
+		if methodName == strings.ToLower(c.typ.Method(i).Name) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *caller) callMethod(ctx context.Context, method reflect.Method, reqPayload []byte, reqParams map[string]string) response {
 	args, cr := c.args(ctx, method, reqPayload, reqParams)
 	if cr != nil {
@@ -362,3 +362,86 @@ func TestStatusCodeInResponse(t *testing.T) {
 	require.Equal(t, http.StatusBadRequest, r.ErrorCode())
 	require.Equal(t, "missing", r.Error())
 }
+
+type queueJob struct {
+	ID string
+}
+
+type queueWorker struct {
+	jobs []string
+}
+
+func (w *queueWorker) OnQueue(ctx context.Context, job queueJob) error {
+	if strings.HasPrefix(job.ID, "fail") {
+		return fmt.Errorf("job %s failed", job.ID)
+	}
+	w.jobs = append(w.jobs, job.ID)
+	return nil
+}
+
+type queueEvents struct{}
+
+func (e *queueEvents) Default(ctx context.Context, event events.SQSEvent) (int, error) {
+	return len(event.Records), nil
+}
+
+func TestQueueHandler(t *testing.T) {
+	// groups of the FIFO queue messages, nil for the standard queue
+	event := func(groups []string, ids ...string) []byte {
+		var e events.SQSEvent
+		for i, id := range ids {
+			body, _ := json.Marshal(queueJob{ID: id})
+			m := events.SQSMessage{
+				MessageId:   fmt.Sprintf("msg%d", i),
+				Body:        string(body),
+				EventSource: "aws:sqs",
+			}
+			if groups != nil {
+				m.Attributes = map[string]string{"MessageGroupId": groups[i]}
+			}
+			e.Records = append(e.Records, m)
+		}
+		buf, _ := json.Marshal(e)
+		return buf
+	}
+	failures := func(rsp response) []string {
+		payload, err := rsp.Raw()
+		require.NoError(t, err)
+		var br sqsBatchResponse
+		require.NoError(t, json.Unmarshal(payload, &br))
+		var ids []string
+		for _, f := range br.BatchItemFailures {
+			ids = append(ids, f.ItemIdentifier)
+		}
+		return ids
+	}
+
+	w := &queueWorker{}
+	handler := newHandler(w)
+	req, rsp := handler.invoke(context.Background(), event(nil, "1", "fail2", "3"))
+	require.Equal(t, RequestType(SQS), req.Type)
+	require.Equal(t, []string{"msg1"}, failures(rsp))
+	require.Equal(t, []string{"1", "3"}, w.jobs)
+
+	// fifo messages after the failed are not processed
+	w.jobs = nil
+	_, rsp = handler.invoke(context.Background(), event([]string{"g", "g", "g"}, "1", "fail2", "3"))
+	require.Equal(t, []string{"msg1", "msg2"}, failures(rsp))
+	require.Equal(t, []string{"1"}, w.jobs)
+
+	// only messages of the failed group
+	w.jobs = nil
+	_, rsp = handler.invoke(context.Background(), event([]string{"a", "b", "a", "b"}, "fail1", "2", "3", "4"))
+	require.Equal(t, []string{"msg0", "msg2"}, failures(rsp))
+	require.Equal(t, []string{"2", "4"}, w.jobs)
+
+	_, rsp = handler.invoke(context.Background(), event(nil, "1", "2"))
+	require.Empty(t, failures(rsp))
+
+	// api without OnQueue gets whole event
+	handler = newHandler(&queueEvents{})
+	_, rsp = handler.invoke(context.Background(), event(nil, "1", "2"))
+	payload, err := rsp.Raw()
+	require.NoError(t, err)
+	require.Equal(t, "2", string(payload))
+}
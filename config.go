@@ -11,8 +11,23 @@ import (
 
 // Configuration environment variables:
 const (
-	EnvConfig      = "MANTIL_GO_CONFIG"
-	EnvKVTableName = "MANTIL_KV_TABLE"
+	EnvConfig         = "MANTIL_GO_CONFIG"
+	EnvKVTableName    = "MANTIL_KV_TABLE"
+	EnvKVCursorSecret = "MANTIL_KV_CURSOR_SECRET"
+	EnvBlobDir        = "MANTIL_BLOB_DIR"
+
+	EnvDynamodbEndpoint = "MANTIL_DYNAMODB_ENDPOINT"
+	EnvS3Endpoint       = "MANTIL_S3_ENDPOINT"
+	EnvLambdaEndpoint   = "MANTIL_LAMBDA_ENDPOINT"
+	EnvKMSEndpoint      = "MANTIL_KMS_ENDPOINT"
+	EnvSTSEndpoint      = "MANTIL_STS_ENDPOINT"
+	EnvSQSEndpoint      = "MANTIL_SQS_ENDPOINT"
+	EnvSNSEndpoint      = "MANTIL_SNS_ENDPOINT"
+	EnvSSMEndpoint      = "MANTIL_SSM_ENDPOINT"
+
+	EnvSecretsManagerEndpoint = "MANTIL_SECRETSMANAGER_ENDPOINT"
+	EnvTaggingEndpoint        = "MANTIL_TAGGING_ENDPOINT"
+	EnvSecretsFile            = "MANTIL_SECRETS_FILE"
 )
 
 type cfg struct {
@@ -47,6 +62,19 @@ func (c cfg) kvTableName() (string, error) {
 	return fmt.Sprintf(c.NamingTemplate, "kv"), nil
 }
 
+// kvCursorSecret returns key for signing KV find cursors.
+// There is no fallback, other config values are visible in resource names.
+func (c cfg) kvCursorSecret() ([]byte, error) {
+	val, err := ensureEnv(EnvKVCursorSecret, "kv cursor secret not found")
+	if err != nil {
+		return nil, err
+	}
+	if val == "" {
+		return nil, fmt.Errorf("kv cursor secret is empty, please set environment variable %s", EnvKVCursorSecret)
+	}
+	return []byte(val), nil
+}
+
 // hackery trick to know if I'm running in `go test`
 // ref: https://stackoverflow.com/questions/14249217/how-do-i-know-im-running-within-go-test
 func (c cfg) isUnitTestEnv() bool {
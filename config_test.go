@@ -3,6 +3,7 @@ package mantil
 import (
 	"encoding/base64"
 	"encoding/json"
+	"log"
 	"os"
 	"strings"
 	"testing"
@@ -13,7 +14,31 @@ import (
 func TestMain(m *testing.M) {
 	logPanic = false
 	setUnitTestConfig(nil)
-	os.Exit(m.Run())
+	code := m.Run()
+	// remove resources left by the unit tests
+	if err := DestroyResources(unitTestResources); err != nil {
+		log.Printf("destroy resources: %s", err)
+	}
+	os.Exit(code)
+}
+
+// unitTestResources selects resources created by the unit tests of the
+// current user. Unit test resources of all users share the tags, so they
+// are matched by name.
+func unitTestResources(ri ResourceInfo) bool {
+	if table, err := config().kvTableName(); err == nil && ri.Name == table {
+		return true
+	}
+	return strings.HasPrefix(ri.Name, Resource("").Name)
+}
+
+func TestUnitTestResources(t *testing.T) {
+	table, err := config().kvTableName()
+	require.NoError(t, err)
+	require.True(t, unitTestResources(ResourceInfo{Name: table}))
+	require.True(t, unitTestResources(ResourceInfo{Name: Resource("bucket").Name}))
+	require.False(t, unitTestResources(ResourceInfo{Name: "mantil-go-other-unit"}))
+	require.False(t, unitTestResources(ResourceInfo{Name: "mantil-go-other-unit-bucket"}))
 }
 
 func TestConfig(t *testing.T) {
@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
@@ -16,11 +15,18 @@ type dynamo struct {
 	client *dynamodb.Client
 }
 
+// newDynamo returns DynamoDB client shared in the process.
 func newDynamo() (*dynamo, error) {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	if awsClients.dynamo != nil {
+		return awsClients.dynamo, nil
+	}
 	d := &dynamo{}
 	if err := d.init(); err != nil {
 		return nil, err
 	}
+	awsClients.dynamo = d
 	return d, nil
 }
 
@@ -28,12 +34,16 @@ func (d *dynamo) init() error {
 	// Using the SDK's default configuration, loading additional config
 	// and credentials values from the environment variables, shared
 	// credentials, and shared configuration files
-	cfg, err := awsConfig.LoadDefaultConfig(context.TODO())
+	cfg, err := loadAWSConfig(context.TODO())
 	if err != nil {
-		return fmt.Errorf("unable to load SDK config, %w", err)
+		return err
 	}
 	// Using the Config value, create the DynamoDB client
-	d.client = dynamodb.NewFromConfig(cfg)
+	d.client = dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if ep := awsEndpoint(EnvDynamodbEndpoint); ep != "" {
+			o.EndpointResolver = dynamodb.EndpointResolverFromURL(ep)
+		}
+	})
 	return nil
 }
 
@@ -46,51 +56,268 @@ func (d *dynamo) init() error {
 // To perform operations on this table, use the returned dynamodb client.
 // Please refer to the AWS SDK documentation for more information on how to use the client:
 // https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/service/dynamodb#Client
+//
+// Table has string primary and sort keys. If sortKey is empty table has
+// only primary key. Use DynamodbTableWithOptions for other key types,
+// indexes, TTL or streams.
 func DynamodbTable(name, primaryKey, sortKey string) (*dynamodb.Client, error) {
+	return DynamodbTableWithOptions(name, TableOptions{
+		PartitionKey: TableKey{Name: primaryKey},
+		SortKey:      TableKey{Name: sortKey},
+	})
+}
+
+// TableOptions describes DynamoDB table created by DynamodbTableWithOptions.
+type TableOptions struct {
+	// PartitionKey is required.
+	PartitionKey TableKey
+	// SortKey is optional, table has only partition key if Name is empty.
+	SortKey TableKey
+	// GlobalIndexes are global secondary indexes. Missing indexes are
+	// created on the existing table.
+	GlobalIndexes []TableIndex
+	// LocalIndexes are local secondary indexes. They have the same
+	// partition key as the table, so only the SortKey of the index is
+	// used. Local indexes can be created only with the table.
+	LocalIndexes []TableIndex
+	// TTLAttribute enables time to live on the attribute.
+	// Attribute holds expiration time as Unix epoch seconds.
+	TTLAttribute string
+	// StreamViewType enables DynamoDB stream with the view type, one of
+	// KEYS_ONLY, NEW_IMAGE, OLD_IMAGE or NEW_AND_OLD_IMAGES.
+	StreamViewType types.StreamViewType
+	// ReadCapacity and WriteCapacity enable provisioned capacity mode.
+	// Table uses on-demand capacity if they are zero. Capacity is set only
+	// when the table or index is created.
+	ReadCapacity  int64
+	WriteCapacity int64
+}
+
+// TableKey is name and type of the table or index key attribute.
+type TableKey struct {
+	Name string
+	// Type is S, N or B. String if empty.
+	Type types.ScalarAttributeType
+}
+
+// TableIndex is a secondary index of the table. Index projects all
+// attributes.
+type TableIndex struct {
+	Name string
+	// PartitionKey of the global index, not used for local indexes.
+	PartitionKey TableKey
+	// SortKey of the index, optional for global indexes.
+	SortKey TableKey
+}
+
+// DynamodbTableWithOptions creates a new dynamodb table (if it doesn't
+// already exist) as DynamodbTable with options for the keys, indexes, TTL,
+// stream and capacity.
+//
+// Existing table is reconciled with the options: missing global indexes are
+// created, TTL and stream enabled. Table settings are never removed.
+// Example:
+//   client, err := mantil.DynamodbTableWithOptions("events", mantil.TableOptions{
+//   	PartitionKey: mantil.TableKey{Name: "id"},
+//   	SortKey:      mantil.TableKey{Name: "ts", Type: types.ScalarAttributeTypeN},
+//   	GlobalIndexes: []mantil.TableIndex{
+//   		{Name: "byUser", PartitionKey: mantil.TableKey{Name: "user"}},
+//   	},
+//   	TTLAttribute:   "expires",
+//   	StreamViewType: types.StreamViewTypeNewImage,
+//   })
+//
+func DynamodbTableWithOptions(name string, opts TableOptions) (*dynamodb.Client, error) {
 	d, err := newDynamo()
 	if err != nil {
 		return nil, err
 	}
 	r := Resource(name)
-	exists, err := d.tableExists(r.Name)
-	if err != nil {
+	if err := d.ensureTable(r.Name, opts); err != nil {
 		return nil, err
 	}
-	if exists {
-		return d.client, nil
+	return d.client, nil
+}
+
+func (o TableOptions) validate() error {
+	if o.PartitionKey.Name == "" {
+		return fmt.Errorf("partition key is required")
 	}
-	if err := d.createTable(r.Name, primaryKey, sortKey); err != nil {
-		return nil, err
+	keys := []TableKey{o.PartitionKey, o.SortKey}
+	for _, i := range o.GlobalIndexes {
+		if i.Name == "" || i.PartitionKey.Name == "" {
+			return fmt.Errorf("global index name and partition key are required")
+		}
+		keys = append(keys, i.PartitionKey, i.SortKey)
 	}
-	return d.client, nil
+	for _, i := range o.LocalIndexes {
+		if i.Name == "" || i.SortKey.Name == "" {
+			return fmt.Errorf("local index name and sort key are required")
+		}
+		if o.SortKey.Name == "" {
+			return fmt.Errorf("local index %s requires table with sort key", i.Name)
+		}
+		keys = append(keys, i.SortKey)
+	}
+	keyTypes := make(map[string]types.ScalarAttributeType)
+	for _, k := range keys {
+		if k.Name == "" {
+			continue
+		}
+		t := k.attributeType()
+		switch t {
+		case types.ScalarAttributeTypeS, types.ScalarAttributeTypeN, types.ScalarAttributeTypeB:
+		default:
+			return fmt.Errorf("key %s has unsupported type %s", k.Name, t)
+		}
+		if kt, ok := keyTypes[k.Name]; ok && kt != t {
+			return fmt.Errorf("key %s is used with types %s and %s", k.Name, kt, t)
+		}
+		keyTypes[k.Name] = t
+	}
+	return nil
 }
 
-func (d *dynamo) createTable(name, primaryKey, sortKey string) error {
-	info("creating dynamodb table %s", name)
-	input := &dynamodb.CreateTableInput{
-		AttributeDefinitions: []types.AttributeDefinition{
-			{
-				AttributeName: aws.String(primaryKey),
-				AttributeType: types.ScalarAttributeTypeS,
-			},
-			{
-				AttributeName: aws.String(sortKey),
-				AttributeType: types.ScalarAttributeTypeS,
-			},
-		},
-		KeySchema: []types.KeySchemaElement{
-			{
-				AttributeName: aws.String(primaryKey),
-				KeyType:       types.KeyTypeHash,
-			},
-			{
-				AttributeName: aws.String(sortKey),
-				KeyType:       types.KeyTypeRange,
-			},
+func (k TableKey) attributeType() types.ScalarAttributeType {
+	if k.Type == "" {
+		return types.ScalarAttributeTypeS
+	}
+	return k.Type
+}
+
+// keySchema returns hash and optional range key schema.
+func keySchema(partitionKey, sortKey TableKey) []types.KeySchemaElement {
+	ks := []types.KeySchemaElement{
+		{
+			AttributeName: aws.String(partitionKey.Name),
+			KeyType:       types.KeyTypeHash,
 		},
+	}
+	if sortKey.Name != "" {
+		ks = append(ks, types.KeySchemaElement{
+			AttributeName: aws.String(sortKey.Name),
+			KeyType:       types.KeyTypeRange,
+		})
+	}
+	return ks
+}
+
+// attributeDefinitions returns definitions of the keys, each attribute once.
+func attributeDefinitions(keys ...TableKey) []types.AttributeDefinition {
+	var ads []types.AttributeDefinition
+	seen := make(map[string]struct{})
+	for _, k := range keys {
+		if _, ok := seen[k.Name]; ok || k.Name == "" {
+			continue
+		}
+		seen[k.Name] = struct{}{}
+		ads = append(ads, types.AttributeDefinition{
+			AttributeName: aws.String(k.Name),
+			AttributeType: k.attributeType(),
+		})
+	}
+	return ads
+}
+
+func (o TableOptions) provisioned() bool {
+	return o.ReadCapacity > 0 || o.WriteCapacity > 0
+}
+
+func (o TableOptions) throughput() *types.ProvisionedThroughput {
+	if !o.provisioned() {
+		return nil
+	}
+	return &types.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(o.ReadCapacity),
+		WriteCapacityUnits: aws.Int64(o.WriteCapacity),
+	}
+}
+
+func (o TableOptions) globalIndex(i TableIndex) types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName:             aws.String(i.Name),
+		KeySchema:             keySchema(i.PartitionKey, i.SortKey),
+		Projection:            &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		ProvisionedThroughput: o.throughput(),
+	}
+}
+
+// ensureTable creates table or reconciles existing table with options.
+// Table is checked once per process for the same options, or until all
+// of its indexes are active.
+func (d *dynamo) ensureTable(name string, opts TableOptions) error {
+	if err := opts.validate(); err != nil {
+		return fmt.Errorf("invalid table %s options, %w", name, err)
+	}
+	resource := fmt.Sprintf("table/%s/%v", name, opts)
+	if isVerified(resource) {
+		return nil
+	}
+	ready, err := d.reconcileTable(name, opts)
+	if err != nil {
+		return err
+	}
+	if ready {
+		setVerified(resource)
+	}
+	return nil
+}
+
+// reconcileTable returns false when some of the indexes are still being
+// created. Table can't be updated during index creation, stream and TTL
+// are reconciled by the later calls when indexes are active.
+func (d *dynamo) reconcileTable(name string, opts TableOptions) (bool, error) {
+	table, err := d.describeTable(name)
+	if err != nil {
+		return false, err
+	}
+	if table == nil {
+		if err := d.createTable(name, opts); err != nil {
+			return false, err
+		}
+	} else {
+		ready, err := d.ensureIndexes(table, opts)
+		if err != nil || !ready {
+			return false, err
+		}
+		if err := d.ensureStream(table, opts.StreamViewType); err != nil {
+			return false, err
+		}
+	}
+	return true, d.ensureTTL(name, opts.TTLAttribute)
+}
+
+// createTableInput builds input for creation of the table with options.
+func createTableInput(name string, opts TableOptions) *dynamodb.CreateTableInput {
+	keys := []TableKey{opts.PartitionKey, opts.SortKey}
+	input := &dynamodb.CreateTableInput{
+		KeySchema:   keySchema(opts.PartitionKey, opts.SortKey),
 		TableName:   aws.String(name),
 		BillingMode: types.BillingModePayPerRequest,
 	}
+	if opts.provisioned() {
+		input.BillingMode = types.BillingModeProvisioned
+		input.ProvisionedThroughput = opts.throughput()
+	}
+	for _, i := range opts.GlobalIndexes {
+		keys = append(keys, i.PartitionKey, i.SortKey)
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, opts.globalIndex(i))
+	}
+	for _, i := range opts.LocalIndexes {
+		keys = append(keys, i.SortKey)
+		input.LocalSecondaryIndexes = append(input.LocalSecondaryIndexes, types.LocalSecondaryIndex{
+			IndexName:  aws.String(i.Name),
+			KeySchema:  keySchema(opts.PartitionKey, i.SortKey),
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		})
+	}
+	input.AttributeDefinitions = attributeDefinitions(keys...)
+	if opts.StreamViewType != "" {
+		input.StreamSpecification = &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: opts.StreamViewType,
+		}
+	}
 
 	tags := []types.Tag{}
 	for k, v := range config().ResourceTags {
@@ -100,8 +327,12 @@ func (d *dynamo) createTable(name, primaryKey, sortKey string) error {
 		})
 	}
 	input.Tags = tags
+	return input
+}
 
-	_, err := d.client.CreateTable(context.TODO(), input)
+func (d *dynamo) createTable(name string, opts TableOptions) error {
+	info("creating dynamodb table %s", name)
+	_, err := d.client.CreateTable(context.TODO(), createTableInput(name, opts))
 	if err != nil {
 		var riu *types.ResourceInUseException
 		if errors.As(err, &riu) {
@@ -127,18 +358,206 @@ func (d *dynamo) createTable(name, primaryKey, sortKey string) error {
 	return nil
 }
 
-func (d *dynamo) tableExists(name string) (bool, error) {
-	input := &dynamodb.DescribeTableInput{
+// describeTable returns table description or nil if the table doesn't exist.
+func (d *dynamo) describeTable(name string) (*types.TableDescription, error) {
+	out, err := d.client.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{
 		TableName: aws.String(name),
-	}
-
-	_, err := d.client.DescribeTable(context.TODO(), input)
+	})
 	if err != nil {
 		var errorType *types.ResourceNotFoundException
 		if errors.As(err, &errorType) {
-			return false, nil
+			return nil, nil
+		}
+		return nil, err
+	}
+	return out.Table, nil
+}
+
+// ensureIndexes starts creation of the global secondary indexes missing on
+// the existing table. It doesn't wait for the index backfill, which can take
+// minutes on large tables. DynamoDB allows creation of only one index at
+// the time, so the rest of the missing indexes are created by the later
+// calls. Returns true when all indexes are active.
+// Local indexes can't be added to the existing table.
+func (d *dynamo) ensureIndexes(table *types.TableDescription, opts TableOptions) (bool, error) {
+	tableName := aws.ToString(table.TableName)
+	for _, i := range opts.LocalIndexes {
+		if !hasLocalIndex(table, i.Name) {
+			return false, fmt.Errorf("local index %s is missing on table %s, local indexes can be created only with the table", i.Name, tableName)
+		}
+	}
+	creating := false
+	for _, gsi := range table.GlobalSecondaryIndexes {
+		if gsi.IndexStatus != types.IndexStatusActive {
+			creating = true
+		}
+	}
+	ready := !creating
+	for _, i := range opts.GlobalIndexes {
+		if hasIndex(table, i.Name) {
+			continue
+		}
+		ready = false
+		if creating {
+			continue
+		}
+		if err := d.createIndex(tableName, opts, i); err != nil {
+			return false, err
+		}
+		creating = true
+	}
+	return ready, nil
+}
+
+func hasIndex(table *types.TableDescription, name string) bool {
+	return globalIndex(table, name) != nil
+}
+
+func globalIndex(table *types.TableDescription, name string) *types.GlobalSecondaryIndexDescription {
+	for _, gsi := range table.GlobalSecondaryIndexes {
+		if aws.ToString(gsi.IndexName) == name {
+			return &gsi
+		}
+	}
+	return nil
+}
+
+func hasLocalIndex(table *types.TableDescription, name string) bool {
+	for _, lsi := range table.LocalSecondaryIndexes {
+		if aws.ToString(lsi.IndexName) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *dynamo) createIndex(tableName string, opts TableOptions, i TableIndex) error {
+	info("creating index %s on dynamodb table %s", i.Name, tableName)
+	gsi := opts.globalIndex(i)
+	_, err := d.client.UpdateTable(context.TODO(), &dynamodb.UpdateTableInput{
+		TableName:            aws.String(tableName),
+		AttributeDefinitions: attributeDefinitions(i.PartitionKey, i.SortKey),
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+			{
+				Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:             gsi.IndexName,
+					KeySchema:             gsi.KeySchema,
+					Projection:            gsi.Projection,
+					ProvisionedThroughput: gsi.ProvisionedThroughput,
+				},
+			},
+		},
+	})
+	if err != nil {
+		// index can be created concurrently by another function instance
+		table, derr := d.describeTable(tableName)
+		if derr != nil || table == nil || !hasIndex(table, i.Name) {
+			return fmt.Errorf("failed to create index %s on table %s, %w", i.Name, tableName, err)
 		}
-		return false, err
 	}
-	return true, nil
+	return nil
+}
+
+// ensureIndexActive returns ErrIndexNotActive if the index is still being
+// created. Active index is checked once per process.
+func (d *dynamo) ensureIndexActive(tableName, indexName string) error {
+	resource := fmt.Sprintf("index/%s/%s", tableName, indexName)
+	if isVerified(resource) {
+		return nil
+	}
+	table, err := d.describeTable(tableName)
+	if err != nil {
+		return err
+	}
+	if table == nil {
+		return fmt.Errorf("table %s not found", tableName)
+	}
+	gsi := globalIndex(table, indexName)
+	if gsi == nil || gsi.IndexStatus != types.IndexStatusActive {
+		return &ErrIndexNotActive{table: tableName, index: indexName}
+	}
+	setVerified(resource)
+	return nil
+}
+
+// ErrIndexNotActive is returned when querying index which is still being
+// created. Index creation on the existing table starts with the first
+// usage and takes time proportional to the table size.
+type ErrIndexNotActive struct {
+	table string
+	index string
+}
+
+func (e ErrIndexNotActive) Error() string {
+	return fmt.Sprintf("index %s on table %s is not active yet", e.index, e.table)
+}
+
+// ensureStream enables stream with the view type on the existing table.
+// Stream with a different view type is not changed, that would require
+// disabling the current stream.
+func (d *dynamo) ensureStream(table *types.TableDescription, viewType types.StreamViewType) error {
+	if viewType == "" {
+		return nil
+	}
+	tableName := aws.ToString(table.TableName)
+	if hasStream(table) {
+		if current := table.StreamSpecification.StreamViewType; current != viewType {
+			return fmt.Errorf("table %s has stream with view type %s, required %s", tableName, current, viewType)
+		}
+		return nil
+	}
+	info("enabling stream on dynamodb table %s", tableName)
+	_, err := d.client.UpdateTable(context.TODO(), &dynamodb.UpdateTableInput{
+		TableName: aws.String(tableName),
+		StreamSpecification: &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: viewType,
+		},
+	})
+	if err != nil {
+		// stream can be enabled concurrently by another function instance
+		table, derr := d.describeTable(tableName)
+		if derr != nil || table == nil || !hasStream(table) {
+			return fmt.Errorf("failed to enable stream on table %s, %w", tableName, err)
+		}
+	}
+	return nil
+}
+
+func hasStream(table *types.TableDescription) bool {
+	return table.StreamSpecification != nil && aws.ToBool(table.StreamSpecification.StreamEnabled)
+}
+
+// ensureTTL enables time to live on the attribute.
+func (d *dynamo) ensureTTL(tableName, attribute string) error {
+	if attribute == "" {
+		return nil
+	}
+	out, err := d.client.DescribeTimeToLive(context.TODO(), &dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return err
+	}
+	if ttl := out.TimeToLiveDescription; ttl != nil {
+		switch ttl.TimeToLiveStatus {
+		case types.TimeToLiveStatusEnabled, types.TimeToLiveStatusEnabling:
+			if current := aws.ToString(ttl.AttributeName); current != attribute {
+				return fmt.Errorf("table %s has time to live on attribute %s, required %s", tableName, current, attribute)
+			}
+			return nil
+		}
+	}
+	info("enabling time to live on dynamodb table %s", tableName)
+	_, err = d.client.UpdateTimeToLive(context.TODO(), &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(attribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable time to live on table %s, %w", tableName, err)
+	}
+	return nil
 }
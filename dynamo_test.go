@@ -2,10 +2,18 @@ package mantil
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -45,3 +53,149 @@ func TestDynamodbTableCreation(t *testing.T) {
 	})
 	require.Nil(t, err)
 }
+
+func TestTableOptionsValidate(t *testing.T) {
+	cases := []struct {
+		opts TableOptions
+		ok   bool
+	}{
+		{TableOptions{PartitionKey: TableKey{Name: pk}}, true},
+		{TableOptions{SortKey: TableKey{Name: sk}}, false},
+		{TableOptions{PartitionKey: TableKey{Name: pk, Type: types.ScalarAttributeTypeN}}, true},
+		{TableOptions{PartitionKey: TableKey{Name: pk, Type: "BOOL"}}, false},
+		{TableOptions{
+			PartitionKey: TableKey{Name: pk},
+			LocalIndexes: []TableIndex{{Name: "lsi", SortKey: TableKey{Name: "ts"}}},
+		}, false},
+		{TableOptions{
+			PartitionKey: TableKey{Name: pk},
+			SortKey:      TableKey{Name: sk},
+			LocalIndexes: []TableIndex{{Name: "lsi", SortKey: TableKey{Name: "ts"}}},
+		}, true},
+		{TableOptions{
+			PartitionKey:  TableKey{Name: pk},
+			GlobalIndexes: []TableIndex{{Name: "gsi"}},
+		}, false},
+		{TableOptions{
+			PartitionKey:  TableKey{Name: pk},
+			GlobalIndexes: []TableIndex{{Name: "gsi", PartitionKey: TableKey{Name: pk, Type: types.ScalarAttributeTypeN}}},
+		}, false},
+	}
+	for i, c := range cases {
+		err := c.opts.validate()
+		if c.ok {
+			require.NoError(t, err, "case %d", i)
+		} else {
+			require.Error(t, err, "case %d", i)
+		}
+	}
+}
+
+func TestCreateTableInput(t *testing.T) {
+	in := createTableInput("table", TableOptions{PartitionKey: TableKey{Name: pk}})
+	require.Len(t, in.KeySchema, 1)
+	require.Len(t, in.AttributeDefinitions, 1)
+	require.Equal(t, types.BillingModePayPerRequest, in.BillingMode)
+	require.Nil(t, in.StreamSpecification)
+
+	in = createTableInput("table", TableOptions{
+		PartitionKey: TableKey{Name: pk},
+		SortKey:      TableKey{Name: sk, Type: types.ScalarAttributeTypeN},
+		GlobalIndexes: []TableIndex{
+			{Name: "gsi", PartitionKey: TableKey{Name: sk, Type: types.ScalarAttributeTypeN}, SortKey: TableKey{Name: "ts"}},
+		},
+		LocalIndexes:   []TableIndex{{Name: "lsi", SortKey: TableKey{Name: "ts"}}},
+		StreamViewType: types.StreamViewTypeNewImage,
+		ReadCapacity:   5,
+		WriteCapacity:  5,
+	})
+	require.Len(t, in.KeySchema, 2)
+	require.Equal(t, types.KeyTypeRange, in.KeySchema[1].KeyType)
+	require.Len(t, in.AttributeDefinitions, 3)
+	require.Equal(t, types.ScalarAttributeTypeN, in.AttributeDefinitions[1].AttributeType)
+	require.Equal(t, types.BillingModeProvisioned, in.BillingMode)
+	require.Equal(t, int64(5), *in.ProvisionedThroughput.ReadCapacityUnits)
+	require.Len(t, in.GlobalSecondaryIndexes, 1)
+	require.NotNil(t, in.GlobalSecondaryIndexes[0].ProvisionedThroughput)
+	require.Len(t, in.LocalSecondaryIndexes, 1)
+	require.Equal(t, pk, *in.LocalSecondaryIndexes[0].KeySchema[0].AttributeName)
+	require.Equal(t, types.StreamViewTypeNewImage, in.StreamSpecification.StreamViewType)
+}
+
+// testDynamo is fake DynamoDB which answers DescribeTable with the table
+// indexes and records UpdateTable index creations.
+type testDynamo struct {
+	mu      sync.Mutex
+	indexes map[string]types.IndexStatus
+	created []string
+}
+
+func (d *testDynamo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	switch op := r.Header.Get("X-Amz-Target"); {
+	case strings.HasSuffix(op, ".DescribeTable"):
+		var gsis []map[string]string
+		for name, status := range d.indexes {
+			gsis = append(gsis, map[string]string{"IndexName": name, "IndexStatus": string(status)})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Table": map[string]interface{}{
+				"TableName":              "table",
+				"TableStatus":            "ACTIVE",
+				"GlobalSecondaryIndexes": gsis,
+			},
+		})
+	case strings.HasSuffix(op, ".UpdateTable"):
+		var in struct {
+			GlobalSecondaryIndexUpdates []struct {
+				Create struct{ IndexName string }
+			}
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		name := in.GlobalSecondaryIndexUpdates[0].Create.IndexName
+		d.created = append(d.created, name)
+		d.indexes[name] = types.IndexStatusCreating
+		w.Write([]byte(`{}`))
+	default:
+		http.Error(w, op, http.StatusBadRequest)
+	}
+}
+
+func TestEnsureIndexesDoesNotWait(t *testing.T) {
+	defer resetAWSClients()
+	svc := &testDynamo{indexes: map[string]types.IndexStatus{}}
+	srv := httptest.NewServer(svc)
+	defer srv.Close()
+	d := &dynamo{client: dynamodb.New(dynamodb.Options{
+		Region:           "local",
+		Credentials:      aws.AnonymousCredentials{},
+		EndpointResolver: dynamodb.EndpointResolverFromURL(srv.URL),
+		Retryer:          aws.NopRetryer{},
+	})}
+	opts := TableOptions{
+		PartitionKey: TableKey{Name: pk},
+		GlobalIndexes: []TableIndex{
+			{Name: "first", PartitionKey: TableKey{Name: "a"}},
+			{Name: "second", PartitionKey: TableKey{Name: "b"}},
+		},
+	}
+
+	// one index is created at the time
+	require.NoError(t, d.ensureTable("table", opts))
+	require.Equal(t, []string{"first"}, svc.created)
+	err := d.ensureIndexActive("table", "first")
+	var ierr *ErrIndexNotActive
+	require.True(t, errors.As(err, &ierr))
+	require.Contains(t, err.Error(), "not active yet")
+
+	require.NoError(t, d.ensureTable("table", opts))
+	require.Equal(t, []string{"first"}, svc.created)
+
+	svc.indexes["first"] = types.IndexStatusActive
+	require.NoError(t, d.ensureIndexActive("table", "first"))
+	require.NoError(t, d.ensureTable("table", opts))
+	require.Equal(t, []string{"first", "second"}, svc.created)
+	require.False(t, isVerified("table/table/"+fmt.Sprintf("%v", opts)))
+}
@@ -1,17 +1,23 @@
 module github.com/mantil-io/mantil.go
 
-go 1.16
+go 1.18
 
 require (
 	github.com/aws/aws-lambda-go v1.24.0
-	github.com/aws/aws-sdk-go-v2 v1.11.1
+	github.com/aws/aws-sdk-go-v2 v1.11.2
 	github.com/aws/aws-sdk-go-v2/config v1.4.1
 	github.com/aws/aws-sdk-go-v2/credentials v1.3.0
 	github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue v1.1.5
 	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.2.0
 	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.4.3
+	github.com/aws/aws-sdk-go-v2/service/kms v1.11.0
 	github.com/aws/aws-sdk-go-v2/service/lambda v1.4.0
+	github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi v1.9.0
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.19.1
+	github.com/aws/aws-sdk-go-v2/service/secretsmanager v1.10.2
+	github.com/aws/aws-sdk-go-v2/service/sns v1.12.1
+	github.com/aws/aws-sdk-go-v2/service/sqs v1.12.1
+	github.com/aws/aws-sdk-go-v2/service/ssm v1.16.0
 	github.com/aws/aws-sdk-go-v2/service/sts v1.5.0
 	github.com/aws/smithy-go v1.9.0
 	github.com/mitchellh/mapstructure v1.4.2
@@ -20,3 +26,27 @@ require (
 	github.com/nats-io/nkeys v0.3.0
 	github.com/stretchr/testify v1.7.0
 )
+
+require (
+	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.0.0 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.1.2 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.0.2 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/ini v1.1.0 // indirect
+	github.com/aws/aws-sdk-go-v2/service/dynamodbstreams v1.3.3 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/accept-encoding v1.5.0 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/endpoint-discovery v1.0.3 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/presigned-url v1.5.1 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/s3shared v1.9.1 // indirect
+	github.com/aws/aws-sdk-go-v2/service/sso v1.3.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/klauspost/compress v1.14.4 // indirect
+	github.com/minio/highwayhash v1.0.2 // indirect
+	github.com/nats-io/jwt/v2 v2.2.1-0.20220113022732-58e87895b296 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/crypto v0.0.0-20220112180741-5e0467b6c7ce // indirect
+	golang.org/x/sys v0.0.0-20220111092808-5a964db01320 // indirect
+	golang.org/x/time v0.0.0-20211116232009-f0f3c7e86c11 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
+)
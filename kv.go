@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -25,11 +26,27 @@ type KV struct {
 	tableName string
 	partition string
 	dynamo    *dynamo
+	indexes   []kvIndex
+	compress  bool
+	// client side encryption of values
+	encryption *kvEncryption
+	// S3 bucket for large values
+	bucket string
+	s3     *s3
+	// cache Get results for cacheTTL, disabled if zero
+	cacheTTL time.Duration
+	// enable DynamoDB stream on the table
+	stream bool
+	// registered entity types
+	entities []entityType
 }
 
+// KVOption configures KV store in NewKV.
+type KVOption func(*KV) error
+
 // NewKV Creates new KV store. All KV stores uses same DynamoDB table. Partition
 // splits that table into independent parts. Each partition has own set of keys.
-func NewKV(partition string) (*KV, error) {
+func NewKV(partition string, opts ...KVOption) (*KV, error) {
 	tn, err := config().kvTableName()
 	if err != nil {
 		return nil, err
@@ -43,11 +60,26 @@ func NewKV(partition string) (*KV, error) {
 		tableName: tn,
 		dynamo:    d,
 	}
+	for _, opt := range opts {
+		if err := opt(&k); err != nil {
+			return nil, err
+		}
+	}
+	if k.bucket != "" {
+		if err := k.initLargeValues(); err != nil {
+			return nil, err
+		}
+	}
 
-	if exists, _ := k.dynamo.tableExists(tn); exists {
-		return &k, nil
+	table := TableOptions{
+		PartitionKey:  TableKey{Name: PK},
+		SortKey:       TableKey{Name: SK},
+		GlobalIndexes: k.globalIndexes(),
+	}
+	if k.stream {
+		table.StreamViewType = types.StreamViewTypeNewAndOldImages
 	}
-	if err := k.dynamo.createTable(tn, PK, SK); err != nil {
+	if err := k.dynamo.ensureTable(tn, table); err != nil {
 		return nil, err
 	}
 	return &k, nil
@@ -59,26 +91,113 @@ func (k *KV) Put(key string, value interface{}) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal record, %w", err)
 	}
-	av[PK] = &types.AttributeValueMemberS{Value: k.partition}
-	av[SK] = &types.AttributeValueMemberS{Value: key}
+	return k.put(key, av)
+}
 
+// put stores value attributes under the key.
+func (k *KV) put(key string, value map[string]types.AttributeValue) error {
+	av, err := k.marshalItem(key, value)
+	if err != nil {
+		return err
+	}
 	input := &dynamodb.PutItemInput{
 		TableName: aws.String(k.tableName),
 		Item:      av,
 	}
+	if k.s3 != nil {
+		input.ReturnValues = types.ReturnValueAllOld
+	}
 
-	_, err = k.dynamo.client.PutItem(context.TODO(), input)
-	return err
+	out, err := k.dynamo.client.PutItem(context.TODO(), input)
+	kvCache.invalidate(k, key)
+	if err != nil {
+		// remove just stored S3 object
+		if o := objectKeyOf(av); o != "" {
+			_ = k.removeObjects(o)
+		}
+		return err
+	}
+	// remove S3 object of the previous value
+	if o := objectKeyOf(out.Attributes); o != "" && o != objectKeyOf(av) {
+		return k.removeObjects(o)
+	}
+	return nil
+}
+
+// PutAuto puts value into kv store under the generated, time ordered, key.
+// Returns generated key, see NewKeyID.
+func (k *KV) PutAuto(value interface{}) (string, error) {
+	key := NewKeyID()
+	return key, k.Put(key, value)
+}
+
+// marshal converts value to the DynamoDB item stored under the key.
+func (k *KV) marshal(key string, value interface{}) (map[string]types.AttributeValue, error) {
+	av, err := attributevalue.MarshalMap(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal record, %w", err)
+	}
+	return k.marshalItem(key, av)
+}
+
+// marshalItem converts value attributes to the DynamoDB item stored under
+// the key. Large value is stored in S3.
+func (k *KV) marshalItem(key string, av map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	item, obj, err := k.marshalItemDeferred(key, av)
+	if err != nil {
+		return nil, err
+	}
+	if obj != nil {
+		if err := k.putObject(obj.key, obj.payload); err != nil {
+			return nil, err
+		}
+	}
+	return item, nil
+}
+
+// marshalItemDeferred is marshalItem which leaves storing of the large value
+// to the caller. Returned object is nil if the value is not offloaded.
+func (k *KV) marshalItemDeferred(key string, av map[string]types.AttributeValue) (map[string]types.AttributeValue, *kvObject, error) {
+	item, obj, err := k.encode(key, av)
+	if err != nil {
+		return nil, nil, err
+	}
+	item[PK] = &types.AttributeValueMemberS{Value: k.partition}
+	item[SK] = &types.AttributeValueMemberS{Value: key}
+	return item, obj, nil
+}
+
+// itemKey returns DynamoDB primary key of the item with the key.
+func (k *KV) itemKey(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		PK: &types.AttributeValueMemberS{Value: k.partition},
+		SK: &types.AttributeValueMemberS{Value: key},
+	}
 }
 
 // Get value for the key.
 // Value provided must be a non-nil pointer type.
-func (k *KV) Get(key string, value interface{}) error {
+// If the cache is enabled value is first looked up in the cache, use
+// NoCache option to bypass it.
+func (k *KV) Get(key string, value interface{}, opts ...GetOption) error {
+	var o getOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	useCache := k.cacheTTL > 0
+	if useCache && !o.noCache {
+		if av, ok := kvCache.get(k, key); ok {
+			return k.unmarshalValue(av, value)
+		}
+	}
+	// read item is cached unless it is changed in the meantime
+	var fill map[string]types.AttributeValue
+	if useCache {
+		version := kvCache.startFill(k, key)
+		defer func() { kvCache.endFill(k, key, version, fill) }()
+	}
 	input := &dynamodb.GetItemInput{
-		Key: map[string]types.AttributeValue{
-			PK: &types.AttributeValueMemberS{Value: k.partition},
-			SK: &types.AttributeValueMemberS{Value: key},
-		},
+		Key:       k.itemKey(key),
 		TableName: aws.String(k.tableName),
 	}
 	result, err := k.dynamo.client.GetItem(context.TODO(), input)
@@ -88,7 +207,36 @@ func (k *KV) Get(key string, value interface{}) error {
 	if result.Item == nil {
 		return &ErrItemNotFound{key: key}
 	}
-	return attributevalue.UnmarshalMap(result.Item, value)
+	av, err := k.decode(result.Item)
+	if err != nil {
+		return err
+	}
+	fill = av
+	return k.unmarshalValue(av, value)
+}
+
+// unmarshalItem converts DynamoDB item to the value.
+func (k *KV) unmarshalItem(item map[string]types.AttributeValue, value interface{}) error {
+	av, err := k.decode(item)
+	if err != nil {
+		return err
+	}
+	return k.unmarshalValue(av, value)
+}
+
+// unmarshalValue converts decoded value attributes to the value.
+// Items decoded into interface{} are converted to the registered entity
+// types, see WithEntity.
+func (k *KV) unmarshalValue(av map[string]types.AttributeValue, value interface{}) error {
+	if p, ok := value.(*interface{}); ok && len(k.entities) > 0 {
+		e, err := k.unmarshalEntity(av)
+		if err != nil {
+			return err
+		}
+		*p = e
+		return nil
+	}
+	return attributevalue.UnmarshalMap(av, value)
 }
 
 // FindOperator is a type representing search criteria for Find operations
@@ -109,6 +257,13 @@ const (
 	FindBetween
 	// FindAll returns all items
 	FindAll
+	// FindChildren searches for items with keys under the given composite
+	// key prefix, see Key
+	FindChildren
+	// FindChildrenBetween searches for items with keys under the composite
+	// key prefix, given as the first argument, which are between the
+	// following two keys
+	FindChildrenBetween
 )
 
 // Find searches KV and returns iterator reading multiple items which satisfies
@@ -122,14 +277,35 @@ const (
 //      ... consume next chunk
 //
 func (k *KV) Find(items interface{}, op FindOperator, args ...string) (*FindIterator, error) {
-	keyCondition, expressionAttributes, err := k.findConditions(op, args...)
+	return k.FindWith(items, op, args)
+}
+
+// FindWith is Find with find options: Desc, Limit, Project, From or Where
+// conditions. Find keys are passed as slice, options are variadic.
+// Example:
+//   // last 20 todos from 2021 which are done
+//   iter, err := kv.FindWith(&todos, FindBeginsWith, []string{"2021-"},
+//   	mantil.Desc(), mantil.Limit(20), mantil.Where("Status", "=", "done"))
+//
+func (k *KV) FindWith(items interface{}, op FindOperator, keys []string, opts ...FindOption) (*FindIterator, error) {
+	keyCondition, expressionAttributes, err := k.findConditions(op, keys...)
 	if err != nil {
 		return nil, err
 	}
-	return k.find(items, 0, keyCondition, expressionAttributes)
+	input := k.queryInput(keyCondition, expressionAttributes)
+	if err := newFindOptions(opts).apply(k, input); err != nil {
+		return nil, err
+	}
+	return k.find(items, input)
 }
 
 func (k *KV) findConditions(op FindOperator, args ...string) (string, map[string]types.AttributeValue, error) {
+	return keyConditions(PK, k.partition, SK, op, args...)
+}
+
+// keyConditions builds query key condition expression where partition key
+// pkName equals pk, and sort key skName satisfies operation.
+func keyConditions(pkName, pk, skName string, op FindOperator, args ...string) (string, map[string]types.AttributeValue, error) {
 	// check for required number of args
 	switch op {
 	case FindBetween:
@@ -140,6 +316,10 @@ func (k *KV) findConditions(op FindOperator, args ...string) (string, map[string
 		if len(args) != 0 {
 			return "", nil, fmt.Errorf("FindAll operation doesn't have arguments, got %d", len(args))
 		}
+	case FindChildrenBetween:
+		if len(args) != 3 {
+			return "", nil, fmt.Errorf("children between operation requires prefix and two keys, got %d arguments", len(args))
+		}
 	default:
 		if len(args) != 1 {
 			return "", nil, fmt.Errorf("operation requires one argument, got %d", len(args))
@@ -149,29 +329,36 @@ func (k *KV) findConditions(op FindOperator, args ...string) (string, map[string
 	// build conditions
 	var keyCondition string
 	expressionAttributes := map[string]types.AttributeValue{
-		":PK": &types.AttributeValueMemberS{Value: k.partition},
+		":PK": &types.AttributeValueMemberS{Value: pk},
 	}
 	switch op {
 	case FindAll:
-		keyCondition = fmt.Sprintf("%s=:PK", PK)
+		keyCondition = fmt.Sprintf("%s=:PK", pkName)
 	case FindBeginsWith:
-		keyCondition = fmt.Sprintf("%s=:PK and begins_with (%s, :begins_with)", PK, SK)
+		keyCondition = fmt.Sprintf("%s=:PK and begins_with (%s, :begins_with)", pkName, skName)
 		expressionAttributes[":begins_with"] = &types.AttributeValueMemberS{Value: args[0]}
 	case FindBetween:
-		keyCondition = fmt.Sprintf("%s=:PK and %s BETWEEN :start and :end", PK, SK)
+		keyCondition = fmt.Sprintf("%s=:PK and %s BETWEEN :start and :end", pkName, skName)
 		expressionAttributes[":start"] = &types.AttributeValueMemberS{Value: args[0]}
 		expressionAttributes[":end"] = &types.AttributeValueMemberS{Value: args[1]}
+	case FindChildren:
+		keyCondition = fmt.Sprintf("%s=:PK and begins_with (%s, :begins_with)", pkName, skName)
+		expressionAttributes[":begins_with"] = &types.AttributeValueMemberS{Value: args[0] + KeySeparator}
+	case FindChildrenBetween:
+		keyCondition = fmt.Sprintf("%s=:PK and %s BETWEEN :start and :end", pkName, skName)
+		expressionAttributes[":start"] = &types.AttributeValueMemberS{Value: args[0] + KeySeparator + args[1]}
+		expressionAttributes[":end"] = &types.AttributeValueMemberS{Value: args[0] + KeySeparator + args[2]}
 	case FindGreaterThan:
-		keyCondition = fmt.Sprintf("%s=:PK and %s > :sk", PK, SK)
+		keyCondition = fmt.Sprintf("%s=:PK and %s > :sk", pkName, skName)
 		expressionAttributes[":sk"] = &types.AttributeValueMemberS{Value: args[0]}
 	case FindGreaterThanOrEqual:
-		keyCondition = fmt.Sprintf("%s=:PK and %s >= :sk", PK, SK)
+		keyCondition = fmt.Sprintf("%s=:PK and %s >= :sk", pkName, skName)
 		expressionAttributes[":sk"] = &types.AttributeValueMemberS{Value: args[0]}
 	case FindLessThanOrEqual:
-		keyCondition = fmt.Sprintf("%s=:PK and %s <= :sk", PK, SK)
+		keyCondition = fmt.Sprintf("%s=:PK and %s <= :sk", pkName, skName)
 		expressionAttributes[":sk"] = &types.AttributeValueMemberS{Value: args[0]}
 	case FindLessThan:
-		keyCondition = fmt.Sprintf("%s=:PK and %s < :sk", PK, SK)
+		keyCondition = fmt.Sprintf("%s=:PK and %s < :sk", pkName, skName)
 		expressionAttributes[":sk"] = &types.AttributeValueMemberS{Value: args[0]}
 	default:
 		return "", nil, fmt.Errorf("unknown find operation")
@@ -181,17 +368,16 @@ func (k *KV) findConditions(op FindOperator, args ...string) (string, map[string
 }
 
 // FindAll return iterator over oll items in KV store.
-func (k *KV) FindAll(items interface{}) (*FindIterator, error) {
-	return k.Find(items, FindAll)
+func (k *KV) FindAll(items interface{}, opts ...FindOption) (*FindIterator, error) {
+	return k.FindWith(items, FindAll, nil, opts...)
 }
 
 func (k *KV) findAllInPages(items interface{}, limit int) (*FindIterator, error) {
-	keyCondition, expressionAttributes, _ := k.findConditions(FindAll)
-	return k.find(items, limit, keyCondition, expressionAttributes)
+	return k.FindAll(items, Limit(limit))
 }
 
-func (k *KV) unmarshal(items interface{}, out *dynamodb.QueryOutput) error {
-	if len(out.Items) == 0 {
+func (k *KV) unmarshal(items interface{}, avs []map[string]types.AttributeValue) error {
+	if len(avs) == 0 {
 		// if there are no results set len of items slice to 0
 		// if result exsits len will be handled in unmarshal
 		t := reflect.TypeOf(items)
@@ -205,7 +391,27 @@ func (k *KV) unmarshal(items interface{}, out *dynamodb.QueryOutput) error {
 			}
 		}
 	}
-	return attributevalue.UnmarshalListOfMaps(out.Items, items)
+	decoded := make([]map[string]types.AttributeValue, 0, len(avs))
+	for _, item := range avs {
+		av, err := k.decode(item)
+		if err != nil {
+			return err
+		}
+		decoded = append(decoded, av)
+	}
+	if p, ok := items.(*[]interface{}); ok && len(k.entities) > 0 {
+		entities := make([]interface{}, 0, len(decoded))
+		for _, av := range decoded {
+			e, err := k.unmarshalEntity(av)
+			if err != nil {
+				return err
+			}
+			entities = append(entities, e)
+		}
+		*p = entities
+		return nil
+	}
+	return attributevalue.UnmarshalListOfMaps(decoded, items)
 }
 
 // FindIterator is used to iterate over a collection of items returned by the Find and FindAll methods
@@ -237,32 +443,85 @@ func (i *FindIterator) Next(items interface{}) error {
 	if !i.HasMore() {
 		return nil
 	}
+	if err := i.fetchNext(); err != nil {
+		return err
+	}
+	return i.k.unmarshal(items, i.queryOutput.Items)
+}
+
+func (i *FindIterator) fetchNext() error {
 	i.queryInput.ExclusiveStartKey = i.queryOutput.LastEvaluatedKey
 	out, err := i.k.dynamo.client.Query(context.TODO(), i.queryInput)
 	if err != nil {
 		return err
 	}
-	if err := i.k.unmarshal(items, out); err != nil {
-		return err
-	}
 	i.queryOutput = out
 	return nil
 }
 
-func (k *KV) find(items interface{}, limit int, keyCondition string, expressionAttributes map[string]types.AttributeValue) (*FindIterator, error) {
-	input := &dynamodb.QueryInput{
+// Each calls fn for each item starting from the last read page, the one
+// returned by Find or last Next, and fetching following pages until all
+// items are consumed.
+// Fn must be a function with single argument of the item type, value or
+// pointer, returning error. Iteration stops on the first fn error.
+// Example:
+//   iter, err := kv.Find(&todos, FindBeginsWith, "2021-")
+//   err = iter.Each(func(t Todo) error {
+//      ... process todo
+//      return nil
+//   })
+//
+func (i *FindIterator) Each(fn interface{}) error {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	if ft.Kind() != reflect.Func || ft.NumIn() != 1 || ft.NumOut() != 1 || ft.Out(0) != errorType {
+		return fmt.Errorf("Each expects func(item) error, got %T", fn)
+	}
+	argType := ft.In(0)
+	itemType := argType
+	if argType.Kind() == reflect.Ptr {
+		itemType = argType.Elem()
+	}
+	for {
+		if i.queryOutput == nil {
+			return nil
+		}
+		for _, item := range i.queryOutput.Items {
+			v := reflect.New(itemType)
+			if err := i.k.unmarshalItem(item, v.Interface()); err != nil {
+				return err
+			}
+			if argType.Kind() != reflect.Ptr {
+				v = v.Elem()
+			}
+			if out := fv.Call([]reflect.Value{v}); !out[0].IsNil() {
+				return out[0].Interface().(error)
+			}
+		}
+		if !i.HasMore() {
+			return nil
+		}
+		if err := i.fetchNext(); err != nil {
+			return err
+		}
+	}
+}
+
+func (k *KV) queryInput(keyCondition string, expressionAttributes map[string]types.AttributeValue) *dynamodb.QueryInput {
+	return &dynamodb.QueryInput{
 		TableName:                 aws.String(k.tableName),
 		KeyConditionExpression:    aws.String(keyCondition),
 		ExpressionAttributeValues: expressionAttributes,
 	}
-	if limit > 0 {
-		input.Limit = aws.Int32(int32(limit))
-	}
+}
+
+func (k *KV) find(items interface{}, input *dynamodb.QueryInput) (*FindIterator, error) {
 	out, err := k.dynamo.client.Query(context.TODO(), input)
 	if err != nil {
 		return nil, err
 	}
-	if err := k.unmarshal(items, out); err != nil {
+	if err := k.unmarshal(items, out.Items); err != nil {
 		return nil, err
 	}
 	return &FindIterator{
@@ -285,6 +544,7 @@ func (k *KV) Delete(key ...string) error {
 
 // DeleteAll removes all keys from KV.
 func (k *KV) DeleteAll() error {
+	defer kvCache.invalidatePartition(k)
 	keyCondition, expressionAttributes, _ := k.findConditions(FindAll)
 	var lastEvaluatedKey map[string]types.AttributeValue
 
@@ -324,40 +584,44 @@ func (k *KV) DeleteAll() error {
 
 func (k *KV) deleteOne(key string) error {
 	input := &dynamodb.DeleteItemInput{
-		Key: map[string]types.AttributeValue{
-			PK: &types.AttributeValueMemberS{Value: k.partition},
-			SK: &types.AttributeValueMemberS{Value: key},
-		},
+		Key:       k.itemKey(key),
 		TableName: aws.String(k.tableName),
 	}
-	_, err := k.dynamo.client.DeleteItem(context.TODO(), input)
-	return err
+	if k.s3 != nil {
+		input.ReturnValues = types.ReturnValueAllOld
+	}
+	out, err := k.dynamo.client.DeleteItem(context.TODO(), input)
+	kvCache.invalidate(k, key)
+	if err != nil {
+		return err
+	}
+	if o := objectKeyOf(out.Attributes); o != "" {
+		return k.removeObjects(o)
+	}
+	return nil
 }
 
 func (k *KV) deleteMany(key ...string) error {
-	for _, chunk := range chunkKeys(key, 25) {
-		input := &dynamodb.BatchWriteItemInput{
-			RequestItems: make(map[string][]types.WriteRequest),
-		}
-		var wrs []types.WriteRequest
-		for _, y := range chunk {
-			wr := types.WriteRequest{
-				DeleteRequest: &types.DeleteRequest{
-					Key: map[string]types.AttributeValue{
-						PK: &types.AttributeValueMemberS{Value: k.partition},
-						SK: &types.AttributeValueMemberS{Value: y},
-					},
-				},
-			}
-			wrs = append(wrs, wr)
-		}
-		input.RequestItems[k.tableName] = wrs
-		_, err := k.dynamo.client.BatchWriteItem(context.TODO(), input)
-		if err != nil {
-			return err
-		}
+	// batch delete doesn't return deleted items
+	// find S3 objects of the offloaded values before delete
+	objects, err := k.storedObjects(key...)
+	if err != nil {
+		return err
 	}
-	return nil
+	var wrs []types.WriteRequest
+	for _, y := range key {
+		wrs = append(wrs, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{
+				Key: k.itemKey(y),
+			},
+		})
+	}
+	_, err = k.batchWrite(wrs)
+	kvCache.invalidate(k, key...)
+	if err != nil {
+		return err
+	}
+	return k.removeObjects(replacedObjects(objects, nil)...)
 }
 
 func chunkKeys(keys []string, chunkSize int) [][]string {
@@ -0,0 +1,265 @@
+package mantil
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoDB limits for the number of items in a single batch request.
+const (
+	batchGetSize   = 100
+	batchWriteSize = 25
+)
+
+// Retry settings for unprocessed items of batch requests.
+// Backoff doubles after each attempt, starting from batchRetryDelay.
+var (
+	batchRetryDelay    = 50 * time.Millisecond
+	batchRetryMaxDelay = 5 * time.Second
+	batchMaxRetries    = 10
+)
+
+// KeyValue is a pair of key and value used in PutMany.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// GetMany reads values for the list of keys.
+// Items must be pointer to a slice. Slice is replaced with the found values
+// in the order of keys. Keys which are not found in the KV are returned as
+// missing.
+// Example:
+//   var users []User
+//   missing, err := kv.GetMany([]string{"ivan", "daniel"}, &users)
+//
+func (k *KV) GetMany(keys []string, items interface{}) ([]string, error) {
+	found := make(map[string]map[string]types.AttributeValue)
+	for _, chunk := range chunkKeys(uniqueKeys(keys), batchGetSize) {
+		var avs []map[string]types.AttributeValue
+		for _, key := range chunk {
+			avs = append(avs, k.itemKey(key))
+		}
+		if err := k.batchGet(avs, func(item map[string]types.AttributeValue) {
+			if v, ok := item[SK].(*types.AttributeValueMemberS); ok {
+				found[v.Value] = item
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var avs []map[string]types.AttributeValue
+	var missing []string
+	for _, key := range keys {
+		item := found[key]
+		if item == nil {
+			missing = append(missing, key)
+			continue
+		}
+		avs = append(avs, item)
+	}
+	if err := k.unmarshal(items, avs); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// PutMany stores multiple values into kv store.
+// Items can be a map with string keys or a slice of KeyValue pairs. When
+// the slice has duplicate keys the last value is stored.
+// Example:
+//   err := kv.PutMany(map[string]User{
+//      "ivan":   {FirstName: "Ivan"},
+//      "daniel": {FirstName: "Daniel"},
+//   })
+//
+func (k *KV) PutMany(items interface{}) error {
+	kvs, err := keyValues(items)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	var avs []map[string]types.AttributeValue
+	for _, kv := range kvs {
+		av, err := attributevalue.MarshalMap(kv.Value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal record, %w", err)
+		}
+		keys = append(keys, kv.Key)
+		avs = append(avs, av)
+	}
+	return k.putMany(keys, avs)
+}
+
+// putMany stores value attributes avs under keys.
+// Large values are stored in S3 before the batch write, and removed if they
+// are not written.
+func (k *KV) putMany(keys []string, avs []map[string]types.AttributeValue) error {
+	keys, avs = lastValues(keys, avs)
+	// batch put doesn't return previous values
+	// find S3 objects of the offloaded values before put
+	objects, err := k.storedObjects(keys...)
+	if err != nil {
+		return err
+	}
+	var wrs []types.WriteRequest
+	var large []*kvObject
+	written := make(map[string]map[string]types.AttributeValue)
+	for i, key := range keys {
+		item, obj, err := k.marshalItemDeferred(key, avs[i])
+		if err != nil {
+			return err
+		}
+		if obj != nil {
+			large = append(large, obj)
+		}
+		wrs = append(wrs, types.WriteRequest{
+			PutRequest: &types.PutRequest{Item: item},
+		})
+		written[key] = item
+	}
+	if err := k.putObjects(large); err != nil {
+		return err
+	}
+	unwritten, err := k.batchWrite(wrs)
+	kvCache.invalidate(k, keys...)
+	if err != nil {
+		_ = k.removeObjects(unwrittenObjects(unwritten)...)
+		return err
+	}
+	return k.removeObjects(replacedObjects(objects, written)...)
+}
+
+// lastValues removes duplicate keys, the last value wins. Batch write
+// rejects requests with duplicate keys.
+func lastValues(keys []string, avs []map[string]types.AttributeValue) ([]string, []map[string]types.AttributeValue) {
+	pos := make(map[string]int)
+	var ks []string
+	var vs []map[string]types.AttributeValue
+	for i, key := range keys {
+		if p, ok := pos[key]; ok {
+			vs[p] = avs[i]
+			continue
+		}
+		pos[key] = len(ks)
+		ks = append(ks, key)
+		vs = append(vs, avs[i])
+	}
+	return ks, vs
+}
+
+// unwrittenObjects returns S3 objects referenced by the put requests.
+func unwrittenObjects(wrs []types.WriteRequest) []string {
+	var objects []string
+	for _, wr := range wrs {
+		if wr.PutRequest == nil {
+			continue
+		}
+		if o := objectKeyOf(wr.PutRequest.Item); o != "" {
+			objects = append(objects, o)
+		}
+	}
+	return objects
+}
+
+func keyValues(items interface{}) ([]KeyValue, error) {
+	if kvs, ok := items.([]KeyValue); ok {
+		return kvs, nil
+	}
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("PutMany expects map with string keys or []KeyValue, got %T", items)
+	}
+	var kvs []KeyValue
+	for _, mk := range v.MapKeys() {
+		kvs = append(kvs, KeyValue{
+			Key:   mk.String(),
+			Value: v.MapIndex(mk).Interface(),
+		})
+	}
+	// map iteration order is random, make writes deterministic
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs, nil
+}
+
+// batchGet reads keys in a single BatchGetItem request and calls fn for each
+// returned item. Keys which DynamoDB leaves unprocessed are retried with
+// backoff.
+func (k *KV) batchGet(keys []map[string]types.AttributeValue, fn func(map[string]types.AttributeValue)) error {
+	requestItems := map[string]types.KeysAndAttributes{
+		k.tableName: {Keys: keys},
+	}
+	return retryBatch(func() (bool, error) {
+		out, err := k.dynamo.client.BatchGetItem(context.TODO(), &dynamodb.BatchGetItemInput{
+			RequestItems: requestItems,
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, item := range out.Responses[k.tableName] {
+			fn(item)
+		}
+		requestItems = out.UnprocessedKeys
+		return len(requestItems[k.tableName].Keys) == 0, nil
+	})
+}
+
+// batchWrite splits write requests into chunks of the BatchWriteItem size.
+// Items which DynamoDB leaves unprocessed are retried with backoff.
+// On error returns write requests which are not written.
+func (k *KV) batchWrite(wrs []types.WriteRequest) ([]types.WriteRequest, error) {
+	for len(wrs) > 0 {
+		size := batchWriteSize
+		if len(wrs) < size {
+			size = len(wrs)
+		}
+		requestItems := map[string][]types.WriteRequest{
+			k.tableName: wrs[:size],
+		}
+		wrs = wrs[size:]
+		if err := retryBatch(func() (bool, error) {
+			out, err := k.dynamo.client.BatchWriteItem(context.TODO(), &dynamodb.BatchWriteItemInput{
+				RequestItems: requestItems,
+			})
+			if err != nil {
+				return false, err
+			}
+			requestItems = out.UnprocessedItems
+			return len(requestItems[k.tableName]) == 0, nil
+		}); err != nil {
+			return append(requestItems[k.tableName], wrs...), err
+		}
+	}
+	return nil, nil
+}
+
+// retryBatch calls fn until it reports that all items are processed, waiting
+// with exponential backoff between attempts.
+func retryBatch(fn func() (bool, error)) error {
+	delay := batchRetryDelay
+	for attempt := 0; ; attempt++ {
+		done, err := fn()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if attempt >= batchMaxRetries {
+			return fmt.Errorf("batch request has unprocessed items after %d retries", batchMaxRetries)
+		}
+		time.Sleep(delay)
+		delay *= 2
+		if delay > batchRetryMaxDelay {
+			delay = batchRetryMaxDelay
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package mantil
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// default max number of items in the KV cache
+const defaultKVCacheSize = 1000
+
+// WithCache enables in-process read-through cache for Get.
+// Items are cached for ttl. Cache is shared by all KV stores in the process
+// so it survives between Lambda invocations of the warm function. Items are
+// invalidated on Put and Delete made through any KV store in the same
+// process. Changes made by other processes are visible after ttl expires.
+// Example:
+//   kv, err := mantil.NewKV("config", mantil.WithCache(time.Minute))
+//
+func WithCache(ttl time.Duration) KVOption {
+	return func(k *KV) error {
+		k.cacheTTL = ttl
+		return nil
+	}
+}
+
+// SetKVCacheSize sets maximum number of items in the KV cache.
+// Least recently used items are removed when cache is full.
+func SetKVCacheSize(size int) {
+	kvCache.setSize(size)
+}
+
+// GetOption modifies Get operation.
+type GetOption func(*getOptions)
+
+type getOptions struct {
+	noCache bool
+}
+
+// NoCache reads item from the DynamoDB bypassing cache.
+// Cache is refreshed with the read item.
+func NoCache() GetOption {
+	return func(o *getOptions) {
+		o.noCache = true
+	}
+}
+
+// CacheStats contains KV cache usage counters.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// CacheStats returns cache hit and miss counters for the KV partition.
+func (k *KV) CacheStats() CacheStats {
+	return kvCache.partitionStats(k.tableName, k.partition)
+}
+
+// process wide KV cache
+var kvCache = newKVItemCache(defaultKVCacheSize)
+
+type kvItemCache struct {
+	mu      sync.Mutex
+	size    int
+	ll      *list.List
+	entries map[cacheKey]*list.Element
+	stats   map[partitionKey]*CacheStats
+	// keys which are being read for filling the cache
+	fills map[cacheKey]*cacheFill
+}
+
+// cacheFill tracks reads of the key in progress. Version is bumped on each
+// invalidation so the value read before the invalidation is not cached.
+type cacheFill struct {
+	readers int
+	version uint64
+}
+
+type partitionKey struct {
+	table     string
+	partition string
+}
+
+type cacheKey struct {
+	partitionKey
+	key string
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	item    map[string]types.AttributeValue
+	expires time.Time
+}
+
+func newKVItemCache(size int) *kvItemCache {
+	return &kvItemCache{
+		size:    size,
+		ll:      list.New(),
+		entries: make(map[cacheKey]*list.Element),
+		stats:   make(map[partitionKey]*CacheStats),
+		fills:   make(map[cacheKey]*cacheFill),
+	}
+}
+
+func (c *kvItemCache) setSize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = size
+	c.evict()
+}
+
+func (c *kvItemCache) get(k *KV, key string) (map[string]types.AttributeValue, bool) {
+	ck := cacheKey{partitionKey{k.tableName, k.partition}, key}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.statsLocked(ck.partitionKey)
+	e, ok := c.entries[ck]
+	if !ok {
+		s.Misses++
+		return nil, false
+	}
+	ce := e.Value.(*cacheEntry)
+	if time.Now().After(ce.expires) {
+		c.removeElement(e)
+		s.Misses++
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	s.Hits++
+	return ce.item, true
+}
+
+// startFill is called before reading the key from DynamoDB. Returned
+// version must be passed to endFill.
+func (c *kvItemCache) startFill(k *KV, key string) uint64 {
+	ck := cacheKey{partitionKey{k.tableName, k.partition}, key}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.fills[ck]
+	if !ok {
+		f = &cacheFill{}
+		c.fills[ck] = f
+	}
+	f.readers++
+	return f.version
+}
+
+// endFill puts read item into cache unless the key was invalidated after
+// startFill. Nil item only ends the fill.
+func (c *kvItemCache) endFill(k *KV, key string, version uint64, item map[string]types.AttributeValue) {
+	ck := cacheKey{partitionKey{k.tableName, k.partition}, key}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.fills[ck]
+	f.readers--
+	if f.readers == 0 {
+		delete(c.fills, ck)
+	}
+	if item == nil || f.version != version {
+		return
+	}
+	c.putLocked(k, ck, item)
+}
+
+func (c *kvItemCache) put(k *KV, key string, item map[string]types.AttributeValue) {
+	ck := cacheKey{partitionKey{k.tableName, k.partition}, key}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.putLocked(k, ck, item)
+}
+
+func (c *kvItemCache) putLocked(k *KV, ck cacheKey, item map[string]types.AttributeValue) {
+	expires := time.Now().Add(k.cacheTTL)
+	if e, ok := c.entries[ck]; ok {
+		ce := e.Value.(*cacheEntry)
+		ce.item = item
+		ce.expires = expires
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.entries[ck] = c.ll.PushFront(&cacheEntry{key: ck, item: item, expires: expires})
+	c.evict()
+}
+
+// invalidate removes keys from cache.
+func (c *kvItemCache) invalidate(k *KV, keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		ck := cacheKey{partitionKey{k.tableName, k.partition}, key}
+		if e, ok := c.entries[ck]; ok {
+			c.removeElement(e)
+		}
+		if f, ok := c.fills[ck]; ok {
+			f.version++
+		}
+	}
+}
+
+// invalidatePartition removes all partition keys from cache.
+func (c *kvItemCache) invalidatePartition(k *KV) {
+	pk := partitionKey{k.tableName, k.partition}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ck, e := range c.entries {
+		if ck.partitionKey == pk {
+			c.removeElement(e)
+		}
+	}
+	for ck, f := range c.fills {
+		if ck.partitionKey == pk {
+			f.version++
+		}
+	}
+}
+
+func (c *kvItemCache) partitionStats(table, partition string) CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *c.statsLocked(partitionKey{table, partition})
+}
+
+func (c *kvItemCache) statsLocked(pk partitionKey) *CacheStats {
+	s, ok := c.stats[pk]
+	if !ok {
+		s = &CacheStats{}
+		c.stats[pk] = s
+	}
+	return s
+}
+
+func (c *kvItemCache) evict() {
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *kvItemCache) removeElement(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.entries, e.Value.(*cacheEntry).key)
+}
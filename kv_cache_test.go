@@ -0,0 +1,121 @@
+package mantil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVCache(t *testing.T) {
+	c := newKVItemCache(2)
+	k := &KV{tableName: "table", partition: "TODOS", cacheTTL: time.Minute}
+	item := func(v string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{"ID": &types.AttributeValueMemberS{Value: v}}
+	}
+
+	_, ok := c.get(k, "1")
+	require.False(t, ok)
+	c.put(k, "1", item("1"))
+	c.put(k, "2", item("2"))
+	av, ok := c.get(k, "1")
+	require.True(t, ok)
+	require.Equal(t, item("1"), av)
+
+	// least recently used is removed
+	c.put(k, "3", item("3"))
+	_, ok = c.get(k, "2")
+	require.False(t, ok)
+	_, ok = c.get(k, "1")
+	require.True(t, ok)
+
+	// invalidate
+	c.invalidate(k, "1")
+	_, ok = c.get(k, "1")
+	require.False(t, ok)
+
+	// partitions are independent
+	other := &KV{tableName: "table", partition: "OTHER", cacheTTL: time.Minute}
+	c.put(other, "3", item("other"))
+	av, ok = c.get(k, "3")
+	require.True(t, ok)
+	require.Equal(t, item("3"), av)
+	c.invalidatePartition(k)
+	_, ok = c.get(k, "3")
+	require.False(t, ok)
+	_, ok = c.get(other, "3")
+	require.True(t, ok)
+
+	// expired
+	short := &KV{tableName: "table", partition: "SHORT", cacheTTL: time.Millisecond}
+	c.put(short, "1", item("1"))
+	time.Sleep(2 * time.Millisecond)
+	_, ok = c.get(short, "1")
+	require.False(t, ok)
+
+	require.Equal(t, CacheStats{Hits: 3, Misses: 4}, c.partitionStats("table", "TODOS"))
+	require.Equal(t, CacheStats{Hits: 0, Misses: 1}, c.partitionStats("table", "SHORT"))
+}
+
+func TestKVCacheFill(t *testing.T) {
+	c := newKVItemCache(10)
+	k := &KV{tableName: "table", partition: "TODOS", cacheTTL: time.Minute}
+	item := map[string]types.AttributeValue{"ID": &types.AttributeValueMemberS{Value: "1"}}
+
+	v := c.startFill(k, "1")
+	c.endFill(k, "1", v, item)
+	_, ok := c.get(k, "1")
+	require.True(t, ok)
+
+	// invalidated while reading, stale item is not cached
+	v = c.startFill(k, "2")
+	v2 := c.startFill(k, "2")
+	c.invalidate(k, "2")
+	v3 := c.startFill(k, "2")
+	c.endFill(k, "2", v, item)
+	c.endFill(k, "2", v2, nil)
+	_, ok = c.get(k, "2")
+	require.False(t, ok)
+	// read started after invalidation is cached
+	c.endFill(k, "2", v3, item)
+	_, ok = c.get(k, "2")
+	require.True(t, ok)
+
+	v = c.startFill(k, "3")
+	c.invalidatePartition(k)
+	c.endFill(k, "3", v, item)
+	_, ok = c.get(k, "3")
+	require.False(t, ok)
+	require.Empty(t, c.fills)
+}
+
+func TestKVGetCached(t *testing.T) {
+	kv, err := NewKV("CACHE", WithCache(time.Minute))
+	require.NoError(t, err)
+	require.NoError(t, kv.DeleteAll())
+
+	require.NoError(t, kv.Put("1", Task{ID: "1", Status: "open"}))
+	var task Task
+	require.NoError(t, kv.Get("1", &task))
+	require.NoError(t, kv.Get("1", &task))
+	require.Equal(t, "open", task.Status)
+	stats := kv.CacheStats()
+	require.Equal(t, uint64(1), stats.Hits)
+
+	// put invalidates cache
+	require.NoError(t, kv.Put("1", Task{ID: "1", Status: "done"}))
+	require.NoError(t, kv.Get("1", &task))
+	require.Equal(t, "done", task.Status)
+
+	// bypass
+	require.NoError(t, kv.Get("1", &task, NoCache()))
+	require.Equal(t, stats.Hits, kv.CacheStats().Hits)
+
+	// delete invalidates cache
+	require.NoError(t, kv.Delete("1"))
+	err = kv.Get("1", &task)
+	require.Error(t, err)
+	var nf *ErrItemNotFound
+	require.ErrorAs(t, err, &nf)
+}
@@ -0,0 +1,430 @@
+package mantil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Encoding of the DynamoDB items to JSON and back.
+// Uses the same format as DynamoDB JSON, where each value is an object with
+// single key describing the type:
+//   {"Name": {"S": "Ivan"}, "Age": {"N": "42"}}
+// Preserves all attribute types, unlike marshaling to the Go values.
+
+func encodeItem(item map[string]types.AttributeValue) ([]byte, error) {
+	m, err := toJSONMap(item)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+func decodeItem(buf []byte) (map[string]types.AttributeValue, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &raw); err != nil {
+		return nil, err
+	}
+	return fromJSONMap(raw)
+}
+
+func toJSONMap(item map[string]types.AttributeValue) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(item))
+	for k, av := range item {
+		v, err := toJSON(av)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func toJSON(av types.AttributeValue) (interface{}, error) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]interface{}{"S": v.Value}, nil
+	case *types.AttributeValueMemberN:
+		return map[string]interface{}{"N": v.Value}, nil
+	case *types.AttributeValueMemberB:
+		return map[string]interface{}{"B": v.Value}, nil
+	case *types.AttributeValueMemberBOOL:
+		return map[string]interface{}{"BOOL": v.Value}, nil
+	case *types.AttributeValueMemberNULL:
+		return map[string]interface{}{"NULL": v.Value}, nil
+	case *types.AttributeValueMemberSS:
+		return map[string]interface{}{"SS": v.Value}, nil
+	case *types.AttributeValueMemberNS:
+		return map[string]interface{}{"NS": v.Value}, nil
+	case *types.AttributeValueMemberBS:
+		return map[string]interface{}{"BS": v.Value}, nil
+	case *types.AttributeValueMemberM:
+		m, err := toJSONMap(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"M": m}, nil
+	case *types.AttributeValueMemberL:
+		l := make([]interface{}, 0, len(v.Value))
+		for _, e := range v.Value {
+			j, err := toJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, j)
+		}
+		return map[string]interface{}{"L": l}, nil
+	default:
+		return nil, fmt.Errorf("unsupported attribute value type %T", av)
+	}
+}
+
+func fromJSONMap(raw map[string]json.RawMessage) (map[string]types.AttributeValue, error) {
+	item := make(map[string]types.AttributeValue, len(raw))
+	for k, r := range raw {
+		av, err := fromJSON(r)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", k, err)
+		}
+		item[k] = av
+	}
+	return item, nil
+}
+
+func fromJSON(buf json.RawMessage) (types.AttributeValue, error) {
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &typed); err != nil {
+		return nil, err
+	}
+	if len(typed) != 1 {
+		return nil, fmt.Errorf("expected single attribute type, got %d", len(typed))
+	}
+	for typ, r := range typed {
+		switch typ {
+		case "S":
+			v := &types.AttributeValueMemberS{}
+			return v, json.Unmarshal(r, &v.Value)
+		case "N":
+			v := &types.AttributeValueMemberN{}
+			return v, json.Unmarshal(r, &v.Value)
+		case "B":
+			v := &types.AttributeValueMemberB{}
+			return v, json.Unmarshal(r, &v.Value)
+		case "BOOL":
+			v := &types.AttributeValueMemberBOOL{}
+			return v, json.Unmarshal(r, &v.Value)
+		case "NULL":
+			v := &types.AttributeValueMemberNULL{}
+			return v, json.Unmarshal(r, &v.Value)
+		case "SS":
+			v := &types.AttributeValueMemberSS{}
+			return v, json.Unmarshal(r, &v.Value)
+		case "NS":
+			v := &types.AttributeValueMemberNS{}
+			return v, json.Unmarshal(r, &v.Value)
+		case "BS":
+			v := &types.AttributeValueMemberBS{}
+			return v, json.Unmarshal(r, &v.Value)
+		case "M":
+			var m map[string]json.RawMessage
+			if err := json.Unmarshal(r, &m); err != nil {
+				return nil, err
+			}
+			item, err := fromJSONMap(m)
+			if err != nil {
+				return nil, err
+			}
+			return &types.AttributeValueMemberM{Value: item}, nil
+		case "L":
+			var l []json.RawMessage
+			if err := json.Unmarshal(r, &l); err != nil {
+				return nil, err
+			}
+			v := &types.AttributeValueMemberL{Value: make([]types.AttributeValue, 0, len(l))}
+			for _, e := range l {
+				av, err := fromJSON(e)
+				if err != nil {
+					return nil, err
+				}
+				v.Value = append(v.Value, av)
+			}
+			return v, nil
+		default:
+			return nil, fmt.Errorf("unknown attribute type %s", typ)
+		}
+	}
+	return nil, nil
+}
+
+// Attributes used when item value is packed into a single binary attribute.
+// Value is packed when it is compressed, encrypted or too large to be stored
+// in DynamoDB and is offloaded to S3.
+const (
+	// packed value attributes
+	attrValue = "_v"
+	// packed value is gzip compressed
+	attrCompressed = "_z"
+	// packed value is stored in S3 object with this key
+	attrObject = "_s3"
+	// packed value is encrypted, id of the master key
+	attrKeyID = "_kid"
+	// data key encrypted with the master key
+	attrDataKey = "_dek"
+)
+
+// internal attributes are never returned to the user
+var internalAttributes = []string{attrValue, attrCompressed, attrObject, attrKeyID, attrDataKey}
+
+// Values larger than compressThreshold are compressed if compression is
+// enabled. Items larger than offloadThreshold are stored in S3 if offload is
+// enabled. DynamoDB max item size is 400KB, threshold leaves room for keys
+// and index attributes.
+const (
+	compressThreshold = 4 * 1024
+	offloadThreshold  = 380 * 1024
+)
+
+// kvObject is the S3 object of the offloaded value.
+type kvObject struct {
+	key     string
+	payload []byte
+}
+
+// encode prepares value attributes for storing in DynamoDB.
+// Returns item without primary key attributes and, for the large values,
+// S3 object referenced by the item which should be stored.
+func (k *KV) encode(key string, av map[string]types.AttributeValue) (map[string]types.AttributeValue, *kvObject, error) {
+	item := make(map[string]types.AttributeValue)
+	k.setIndexAttributes(key, av, item)
+	size := itemSize(av)
+	if k.encryption == nil && !(k.compress && size > compressThreshold) && size <= offloadThreshold {
+		for name, v := range av {
+			item[name] = v
+		}
+		return item, nil, nil
+	}
+
+	// entity type and indexed attributes are never packed so they can be
+	// used in filters
+	packed := make(map[string]types.AttributeValue)
+	inClear := k.clearAttributes()
+	for name, v := range av {
+		if inClear[name] {
+			item[name] = v
+			continue
+		}
+		packed[name] = v
+	}
+	payload, err := encodeItem(packed)
+	if err != nil {
+		return nil, nil, err
+	}
+	if k.compress && len(payload) > compressThreshold {
+		if z, err := gzipBytes(payload); err == nil && len(z) < len(payload) {
+			payload = z
+			item[attrCompressed] = &types.AttributeValueMemberBOOL{Value: true}
+		}
+	}
+	if k.encryption != nil {
+		keyID, dataKey, ciphertext, err := k.encryption.encrypt(payload, additionalData(k.partition, key))
+		if err != nil {
+			return nil, nil, err
+		}
+		payload = ciphertext
+		item[attrKeyID] = &types.AttributeValueMemberS{Value: keyID}
+		item[attrDataKey] = &types.AttributeValueMemberB{Value: dataKey}
+	}
+	if len(payload) > offloadThreshold {
+		if k.s3 == nil {
+			return nil, nil, fmt.Errorf("value for key %s is %d bytes, larger than DynamoDB item size limit, use WithLargeValues option to store it in S3", key, len(payload))
+		}
+		obj := &kvObject{key: k.objectKey(key), payload: payload}
+		item[attrObject] = &types.AttributeValueMemberS{Value: obj.key}
+		return item, obj, nil
+	}
+	item[attrValue] = &types.AttributeValueMemberB{Value: payload}
+	return item, nil, nil
+}
+
+// clearAttributes returns names of the value attributes which are stored
+// in clear when the value is packed.
+// packsValues reports whether values can be packed into the internal
+// attribute by compression, encryption or offload to S3.
+func (k *KV) packsValues() bool {
+	return k.compress || k.s3 != nil || k.encryption != nil
+}
+
+// checkClearAttribute returns error if the attribute can be packed, it can't
+// be used in conditions and update expressions. Keys and the attributes
+// kept in clear can always be used.
+func (k *KV) checkClearAttribute(attribute string) error {
+	if !k.packsValues() || attribute == PK || attribute == SK || k.clearAttributes()[attribute] {
+		return nil
+	}
+	return fmt.Errorf("attribute %s can be packed by compression, encryption or offload to S3, only indexed attributes can be used in conditions and updates", attribute)
+}
+
+// checkConditions checks attributes of the conditions, see checkClearAttribute.
+func (k *KV) checkConditions(conds []Condition) error {
+	for _, c := range conds {
+		if err := k.checkClearAttribute(c.attribute); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k *KV) clearAttributes() map[string]bool {
+	names := map[string]bool{attrType: true}
+	for _, i := range k.indexes {
+		names[i.attribute] = true
+		if i.sortAttribute != "" {
+			names[i.sortAttribute] = true
+		}
+	}
+	return names
+}
+
+// decode reverts encode. Returns item with the value attributes.
+func (k *KV) decode(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	var payload []byte
+	switch {
+	case item[attrObject] != nil:
+		objectKey, _ := item[attrObject].(*types.AttributeValueMemberS)
+		if objectKey == nil || k.s3 == nil {
+			return nil, fmt.Errorf("value is stored in S3, use WithLargeValues option to read it")
+		}
+		buf, err := k.getObject(objectKey.Value)
+		if err != nil {
+			return nil, err
+		}
+		payload = buf
+	case item[attrValue] != nil:
+		v, _ := item[attrValue].(*types.AttributeValueMemberB)
+		if v == nil {
+			return nil, fmt.Errorf("invalid packed value type %T", item[attrValue])
+		}
+		payload = v.Value
+	default:
+		return item, nil
+	}
+	if _, ok := item[attrKeyID]; ok {
+		buf, err := k.decrypt(item, payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = buf
+	}
+	if _, ok := item[attrCompressed]; ok {
+		buf, err := gunzipBytes(payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = buf
+	}
+	av, err := decodeItem(payload)
+	if err != nil {
+		return nil, err
+	}
+	for name, v := range item {
+		av[name] = v
+	}
+	for _, name := range internalAttributes {
+		delete(av, name)
+	}
+	return av, nil
+}
+
+func (k *KV) decrypt(item map[string]types.AttributeValue, ciphertext []byte) ([]byte, error) {
+	if k.encryption == nil {
+		return nil, fmt.Errorf("value is encrypted, use WithEncryption option to read it")
+	}
+	keyID, _ := item[attrKeyID].(*types.AttributeValueMemberS)
+	dataKey, _ := item[attrDataKey].(*types.AttributeValueMemberB)
+	pk, _ := item[PK].(*types.AttributeValueMemberS)
+	sk, _ := item[SK].(*types.AttributeValueMemberS)
+	if keyID == nil || dataKey == nil || pk == nil || sk == nil {
+		return nil, fmt.Errorf("missing encryption attributes")
+	}
+	return k.encryption.decrypt(keyID.Value, dataKey.Value, ciphertext, additionalData(pk.Value, sk.Value))
+}
+
+// additionalData binds encrypted value to the item key so it can't be
+// copied to another item.
+func additionalData(partition, key string) []byte {
+	return []byte(partition + "\x00" + key)
+}
+
+// itemSize approximates DynamoDB item size.
+// Ref: https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/CapacityUnitCalculations.html
+func itemSize(item map[string]types.AttributeValue) int {
+	size := 0
+	for name, av := range item {
+		size += len(name) + attributeSize(av)
+	}
+	return size
+}
+
+func attributeSize(av types.AttributeValue) int {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return len(v.Value)
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberSS:
+		size := 0
+		for _, s := range v.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberNS:
+		size := 0
+		for _, s := range v.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberBS:
+		size := 0
+		for _, b := range v.Value {
+			size += len(b)
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		return 3 + itemSize(v.Value)
+	case *types.AttributeValueMemberL:
+		size := 3
+		for _, e := range v.Value {
+			size += 1 + attributeSize(e)
+		}
+		return size
+	default:
+		return 1
+	}
+}
+
+func gzipBytes(buf []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func gunzipBytes(buf []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,101 @@
+package mantil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVEncodeDecode(t *testing.T) {
+	k := &KV{partition: "TODOS"}
+	require.NoError(t, WithIndex("byStatus", "Status", "")(k))
+
+	small := Task{ID: "1", Status: "done", Due: "2021-10-01"}
+	large := Task{ID: "2", Status: "open", Due: strings.Repeat("2021-10-01 ", 1000)}
+
+	// without compression value attributes are stored as they are
+	item, err := k.marshal("1", small)
+	require.NoError(t, err)
+	require.Nil(t, item[attrValue])
+	require.Equal(t, &types.AttributeValueMemberS{Value: "done"}, item["Status"])
+
+	item, err = k.marshal("2", large)
+	require.NoError(t, err)
+	require.Nil(t, item[attrValue])
+
+	// compression packs large values
+	require.NoError(t, WithCompression()(k))
+	item, err = k.marshal("1", small)
+	require.NoError(t, err)
+	require.Nil(t, item[attrValue])
+
+	item, err = k.marshal("2", large)
+	require.NoError(t, err)
+	require.NotNil(t, item[attrValue])
+	require.NotNil(t, item[attrCompressed])
+	require.Nil(t, item["Due"])
+	require.Less(t, itemSize(item), 1024)
+	// index attributes are not packed
+	require.Equal(t, &types.AttributeValueMemberS{Value: "TODOS#open"}, item["byStatus_PK"])
+
+	var task Task
+	require.NoError(t, k.unmarshalItem(item, &task))
+	require.Equal(t, large, task)
+
+	var m map[string]interface{}
+	require.NoError(t, k.unmarshalItem(item, &m))
+	require.NotContains(t, m, attrValue)
+	require.NotContains(t, m, attrCompressed)
+	require.Equal(t, "2", m[SK])
+
+	// too large without S3
+	huge := Task{ID: "3", Due: strings.Repeat("x", offloadThreshold)}
+	k.compress = false
+	_, err = k.marshal("3", huge)
+	require.Error(t, err)
+}
+
+func TestItemSize(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"S": &types.AttributeValueMemberS{Value: "abc"},
+		"L": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberN{Value: "12"},
+		}},
+		"M": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"B": &types.AttributeValueMemberBOOL{Value: true},
+		}},
+	}
+	require.Equal(t, 1+3+1+3+1+2+1+3+1+1, itemSize(item))
+}
+
+func TestEncodeItem(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"S":    &types.AttributeValueMemberS{Value: "string"},
+		"N":    &types.AttributeValueMemberN{Value: "42"},
+		"B":    &types.AttributeValueMemberB{Value: []byte{1, 2, 3}},
+		"BOOL": &types.AttributeValueMemberBOOL{Value: true},
+		"NULL": &types.AttributeValueMemberNULL{Value: true},
+		"SS":   &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"NS":   &types.AttributeValueMemberNS{Value: []string{"1", "2"}},
+		"BS":   &types.AttributeValueMemberBS{Value: [][]byte{{1}, {2}}},
+		"M": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"empty": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}},
+		}},
+		"L": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "a"},
+			&types.AttributeValueMemberN{Value: "1"},
+		}},
+	}
+	buf, err := encodeItem(item)
+	require.NoError(t, err)
+	decoded, err := decodeItem(buf)
+	require.NoError(t, err)
+	require.Equal(t, item, decoded)
+
+	_, err = decodeItem([]byte(`{"S": {"X": "1"}}`))
+	require.Error(t, err)
+	_, err = decodeItem([]byte(`{"S": {"S": "1", "N": "1"}}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,113 @@
+package mantil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// cursor is the content of the token returned by FindIterator.Cursor
+type cursor struct {
+	Partition string          `json:"p"`
+	Index     string          `json:"i,omitempty"`
+	Key       json.RawMessage `json:"k"`
+}
+
+// Cursor returns opaque token of the iterator position after the last read
+// page. Token can be sent to the client and used later in FindFrom, or with
+// the From option, to continue reading from that position.
+// Token is signed so any client modification is detected. Signing key is
+// read from the MANTIL_KV_CURSOR_SECRET environment variable, error is
+// returned if it is not set.
+// Returns empty string if there are no more items.
+func (i *FindIterator) Cursor() (string, error) {
+	if !i.HasMore() {
+		return "", nil
+	}
+	key, err := encodeItem(i.queryOutput.LastEvaluatedKey)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(cursor{
+		Partition: i.k.partition,
+		Index:     aws.ToString(i.queryInput.IndexName),
+		Key:       key,
+	})
+	if err != nil {
+		return "", err
+	}
+	p := base64.RawURLEncoding.EncodeToString(payload)
+	sig, err := signCursor(p)
+	if err != nil {
+		return "", err
+	}
+	return p + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// From continues Find from the position of the cursor returned by
+// FindIterator.Cursor. Find must be called with the same arguments as
+// the one which created cursor.
+func From(cursor string) FindOption {
+	return findOptionFunc(func(o *findOptions) {
+		o.cursor = cursor
+	})
+}
+
+// FindFrom continues Find from the cursor position.
+// Empty cursor starts from the beginning. To use other find options add
+// From option to FindWith.
+// Example:
+//   iter, err := kv.FindWith(&todos, FindAll, nil, mantil.Limit(20))
+//   next, err := iter.Cursor()
+//   ... return todos and next to the client
+//   ... on the next client request
+//   iter, err := kv.FindWith(&todos, FindAll, nil, mantil.Limit(20), mantil.From(next))
+//
+func (k *KV) FindFrom(cursor string, items interface{}, op FindOperator, args ...string) (*FindIterator, error) {
+	return k.FindWith(items, op, args, From(cursor))
+}
+
+func signCursor(payload string) ([]byte, error) {
+	secret, err := config().kvCursorSecret()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil), nil
+}
+
+// parseCursor verifies cursor signature and returns start key for the query.
+func (k *KV) parseCursor(token, index string) (map[string]types.AttributeValue, error) {
+	invalid := fmt.Errorf("invalid cursor")
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, invalid
+	}
+	expected, err := signCursor(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, expected) {
+		return nil, invalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, invalid
+	}
+	var c cursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, invalid
+	}
+	if c.Partition != k.partition || c.Index != index {
+		return nil, fmt.Errorf("cursor is not created for this partition and index")
+	}
+	return decodeItem(c.Key)
+}
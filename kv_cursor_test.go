@@ -0,0 +1,119 @@
+package mantil
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor(t *testing.T) {
+	t.Setenv(EnvKVCursorSecret, "secret")
+	k := &KV{partition: "TODOS"}
+	lastKey := map[string]types.AttributeValue{
+		PK: &types.AttributeValueMemberS{Value: "TODOS"},
+		SK: &types.AttributeValueMemberS{Value: "5"},
+	}
+	iter := &FindIterator{
+		k:           k,
+		queryInput:  &dynamodb.QueryInput{},
+		queryOutput: &dynamodb.QueryOutput{LastEvaluatedKey: lastKey},
+	}
+	c, err := iter.Cursor()
+	require.NoError(t, err)
+	require.NotEmpty(t, c)
+
+	key, err := k.parseCursor(c, "")
+	require.NoError(t, err)
+	require.Equal(t, lastKey, key)
+
+	// cursor from another partition or index
+	_, err = (&KV{partition: "USERS"}).parseCursor(c, "")
+	require.Error(t, err)
+	_, err = k.parseCursor(c, "byStatus")
+	require.Error(t, err)
+
+	// tampered cursor
+	parts := strings.Split(c, ".")
+	_, err = k.parseCursor(parts[0]+"x."+parts[1], "")
+	require.Error(t, err)
+	_, err = k.parseCursor(parts[0], "")
+	require.Error(t, err)
+
+	// cursor signed with another secret
+	t.Setenv(EnvKVCursorSecret, "other")
+	_, err = k.parseCursor(c, "")
+	require.Error(t, err)
+
+	// fails without secret
+	t.Setenv(EnvKVCursorSecret, "")
+	_, err = iter.Cursor()
+	require.Error(t, err)
+	_, err = k.parseCursor(c, "")
+	require.Error(t, err)
+
+	iter.queryOutput.LastEvaluatedKey = nil
+	c, err = iter.Cursor()
+	require.NoError(t, err)
+	require.Empty(t, c)
+}
+
+func TestFindIteratorEach(t *testing.T) {
+	iter := &FindIterator{
+		k:          &KV{},
+		queryInput: &dynamodb.QueryInput{},
+		queryOutput: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+			{"ID": &types.AttributeValueMemberS{Value: "1"}},
+			{"ID": &types.AttributeValueMemberS{Value: "2"}},
+		}},
+	}
+	var ids []string
+	err := iter.Each(func(t Todo) error {
+		ids = append(ids, t.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2"}, ids)
+
+	err = iter.Each(func(t *Todo) error {
+		return fmt.Errorf("stop at %s", t.ID)
+	})
+	require.EqualError(t, err, "stop at 1")
+
+	require.Error(t, iter.Each(func(t Todo) {}))
+	require.Error(t, iter.Each("not a func"))
+}
+
+func TestKVFindFrom(t *testing.T) {
+	t.Setenv(EnvKVCursorSecret, "secret")
+	kv, err := NewKV(todosPartition)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, kv.Put(fmt.Sprintf("%d", i), Todo{ID: fmt.Sprintf("%d", i)}))
+	}
+
+	var todos []Todo
+	iter, err := kv.FindWith(&todos, FindAll, nil, Limit(2))
+	require.NoError(t, err)
+	require.Len(t, todos, 2)
+
+	next, err := iter.Cursor()
+	require.NoError(t, err)
+	iter, err = kv.FindWith(&todos, FindAll, nil, Limit(2), From(next))
+	require.NoError(t, err)
+	require.Len(t, todos, 2)
+	require.Equal(t, "2", todos[0].ID)
+
+	var ids []string
+	err = iter.Each(func(t Todo) error {
+		ids = append(ids, t.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"2", "3", "4"}, ids)
+
+	require.NoError(t, kv.DeleteAll())
+}
@@ -0,0 +1,268 @@
+package mantil
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// KeyProvider provides data keys for the envelope encryption of KV values.
+// Each value is encrypted with the data key. Data key is encrypted with the
+// master key and stored with the value together with the master key id.
+// That enables rotation of the master keys; values encrypted with the old
+// master key are still readable while new values use the current key.
+type KeyProvider interface {
+	// GenerateDataKey returns new 256 bit data key, in plaintext and
+	// encrypted with the current master key, and the id of that master key.
+	GenerateDataKey() (keyID string, plaintext, encrypted []byte, err error)
+	// DecryptDataKey decrypts data key encrypted with the master key keyID.
+	DecryptDataKey(keyID string, encrypted []byte) ([]byte, error)
+}
+
+// WithEncryption enables client side encryption of the values.
+// All value attributes are encrypted, except attributes of the declared
+// indexes, see WithIndex. Primary key and index attributes are stored in
+// clear, so only they can be used in Where conditions.
+// Example:
+//   kp, err := mantil.NewKMSKeyProvider("alias/my-key")
+//   kv, err := mantil.NewKV("tokens", mantil.WithEncryption(kp))
+//
+func WithEncryption(p KeyProvider) KVOption {
+	return func(k *KV) error {
+		if p == nil {
+			return fmt.Errorf("key provider is required")
+		}
+		k.encryption = newKVEncryption(p)
+		return nil
+	}
+}
+
+// Data key is reused for dataKeyMaxAge or dataKeyMaxUses encryptions to
+// reduce number of calls to key provider.
+const (
+	dataKeyMaxAge        = 5 * time.Minute
+	dataKeyMaxUses       = 10000
+	decryptedKeysMaxSize = 1000
+)
+
+// kvEncryption encrypts values with AES-GCM using data keys from the
+// provider. Caches data keys.
+type kvEncryption struct {
+	provider KeyProvider
+	mu       sync.Mutex
+	current  *dataKey
+	// decrypted data keys by encrypted data key
+	decrypted map[string][]byte
+}
+
+type dataKey struct {
+	keyID     string
+	plaintext []byte
+	encrypted []byte
+	created   time.Time
+	uses      int
+}
+
+func newKVEncryption(p KeyProvider) *kvEncryption {
+	return &kvEncryption{
+		provider:  p,
+		decrypted: make(map[string][]byte),
+	}
+}
+
+func (e *kvEncryption) dataKey() (*dataKey, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c := e.current
+	if c != nil && c.uses < dataKeyMaxUses && time.Since(c.created) < dataKeyMaxAge {
+		c.uses++
+		return c, nil
+	}
+	keyID, plaintext, encrypted, err := e.provider.GenerateDataKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate data key, %w", err)
+	}
+	e.current = &dataKey{
+		keyID:     keyID,
+		plaintext: plaintext,
+		encrypted: encrypted,
+		created:   time.Now(),
+		uses:      1,
+	}
+	return e.current, nil
+}
+
+func (e *kvEncryption) decryptDataKey(keyID string, encrypted []byte) ([]byte, error) {
+	ck := keyID + "/" + string(encrypted)
+	e.mu.Lock()
+	plaintext, ok := e.decrypted[ck]
+	e.mu.Unlock()
+	if ok {
+		return plaintext, nil
+	}
+	plaintext, err := e.provider.DecryptDataKey(keyID, encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key, %w", err)
+	}
+	e.mu.Lock()
+	if len(e.decrypted) >= decryptedKeysMaxSize {
+		e.decrypted = make(map[string][]byte)
+	}
+	e.decrypted[ck] = plaintext
+	e.mu.Unlock()
+	return plaintext, nil
+}
+
+// encrypt returns master key id, encrypted data key and ciphertext.
+// Additional data binds ciphertext to the item.
+func (e *kvEncryption) encrypt(plaintext, additionalData []byte) (string, []byte, []byte, error) {
+	dk, err := e.dataKey()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	ciphertext, err := sealAESGCM(dk.plaintext, plaintext, additionalData)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return dk.keyID, dk.encrypted, ciphertext, nil
+}
+
+func (e *kvEncryption) decrypt(keyID string, encryptedDataKey, ciphertext, additionalData []byte) ([]byte, error) {
+	key, err := e.decryptDataKey(keyID, encryptedDataKey)
+	if err != nil {
+		return nil, err
+	}
+	return openAESGCM(key, ciphertext, additionalData)
+}
+
+// sealAESGCM encrypts plaintext, random nonce is prepended to the ciphertext.
+func sealAESGCM(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openAESGCM(key, ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// StaticKeyProvider encrypts data keys with master keys provided by the
+// application. Intended for tests and environments without KMS.
+type StaticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeyProvider creates key provider with 256 bit master keys mapped
+// by key id. New data keys are encrypted with the current key, others are
+// used only for decryption of the existing values.
+func NewStaticKeyProvider(current string, keys map[string][]byte) (*StaticKeyProvider, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current key %s not found", current)
+	}
+	for id, k := range keys {
+		if len(k) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes long, got %d", id, len(k))
+		}
+	}
+	return &StaticKeyProvider{
+		current: current,
+		keys:    keys,
+	}, nil
+}
+
+// GenerateDataKey implements KeyProvider interface.
+func (p *StaticKeyProvider) GenerateDataKey() (string, []byte, []byte, error) {
+	plaintext := make([]byte, 32)
+	if _, err := rand.Read(plaintext); err != nil {
+		return "", nil, nil, err
+	}
+	encrypted, err := sealAESGCM(p.keys[p.current], plaintext, []byte(p.current))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return p.current, plaintext, encrypted, nil
+}
+
+// DecryptDataKey implements KeyProvider interface.
+func (p *StaticKeyProvider) DecryptDataKey(keyID string, encrypted []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", keyID)
+	}
+	return openAESGCM(key, encrypted, []byte(keyID))
+}
+
+// KMSKeyProvider uses AWS KMS key as the master key.
+// Key rotation is handled by KMS.
+type KMSKeyProvider struct {
+	keyID  string
+	client *kms.Client
+}
+
+// NewKMSKeyProvider creates key provider for the KMS key.
+// KeyID can be key id, arn, alias name or alias arn.
+func NewKMSKeyProvider(keyID string) (*KMSKeyProvider, error) {
+	client, err := kmsClient()
+	if err != nil {
+		return nil, err
+	}
+	return &KMSKeyProvider{
+		keyID:  keyID,
+		client: client,
+	}, nil
+}
+
+// GenerateDataKey implements KeyProvider interface.
+func (p *KMSKeyProvider) GenerateDataKey() (string, []byte, []byte, error) {
+	out, err := p.client.GenerateDataKey(context.TODO(), &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(p.keyID),
+		KeySpec: kmstypes.DataKeySpecAes256,
+	})
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return aws.ToString(out.KeyId), out.Plaintext, out.CiphertextBlob, nil
+}
+
+// DecryptDataKey implements KeyProvider interface.
+func (p *KMSKeyProvider) DecryptDataKey(keyID string, encrypted []byte) ([]byte, error) {
+	out, err := p.client.Decrypt(context.TODO(), &kms.DecryptInput{
+		KeyId:          aws.String(keyID),
+		CiphertextBlob: encrypted,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
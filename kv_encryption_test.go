@@ -0,0 +1,78 @@
+package mantil
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyProvider(t *testing.T, current string) *StaticKeyProvider {
+	p, err := NewStaticKeyProvider(current, map[string][]byte{
+		"key1": bytes.Repeat([]byte{1}, 32),
+		"key2": bytes.Repeat([]byte{2}, 32),
+	})
+	require.NoError(t, err)
+	return p
+}
+
+func TestKVEncryption(t *testing.T) {
+	k := &KV{partition: "TOKENS"}
+	require.NoError(t, WithIndex("byStatus", "Status", "")(k))
+	require.NoError(t, WithEncryption(testKeyProvider(t, "key1"))(k))
+
+	task := Task{ID: "1", Status: "done", Due: "2021-10-01"}
+	item, err := k.marshal("1", task)
+	require.NoError(t, err)
+	require.Nil(t, item["Due"])
+	// index attribute is in clear
+	require.Equal(t, &types.AttributeValueMemberS{Value: "done"}, item["Status"])
+	require.Equal(t, &types.AttributeValueMemberS{Value: "key1"}, item[attrKeyID])
+	require.NotNil(t, item[attrDataKey])
+	require.NotNil(t, item[attrValue])
+	// keys are in clear
+	require.Equal(t, &types.AttributeValueMemberS{Value: "TOKENS#done"}, item["byStatus_PK"])
+	require.Equal(t, &types.AttributeValueMemberS{Value: "1"}, item[SK])
+
+	var decoded Task
+	require.NoError(t, k.unmarshalItem(item, &decoded))
+	require.Equal(t, task, decoded)
+
+	// rotate master key, old values are still readable
+	k2 := &KV{partition: "TOKENS"}
+	require.NoError(t, WithEncryption(testKeyProvider(t, "key2"))(k2))
+	decoded = Task{}
+	require.NoError(t, k2.unmarshalItem(item, &decoded))
+	require.Equal(t, task, decoded)
+	item2, err := k2.marshal("1", task)
+	require.NoError(t, err)
+	require.Equal(t, &types.AttributeValueMemberS{Value: "key2"}, item2[attrKeyID])
+
+	// value copied to another key can't be decrypted
+	item[SK] = &types.AttributeValueMemberS{Value: "2"}
+	require.Error(t, k.unmarshalItem(item, &decoded))
+
+	// without encryption option
+	require.Error(t, (&KV{}).unmarshalItem(item2, &decoded))
+}
+
+func TestStaticKeyProvider(t *testing.T) {
+	_, err := NewStaticKeyProvider("key3", map[string][]byte{"key1": bytes.Repeat([]byte{1}, 32)})
+	require.Error(t, err)
+	_, err = NewStaticKeyProvider("key1", map[string][]byte{"key1": []byte("short")})
+	require.Error(t, err)
+
+	p := testKeyProvider(t, "key1")
+	id, plaintext, encrypted, err := p.GenerateDataKey()
+	require.NoError(t, err)
+	require.Equal(t, "key1", id)
+	require.Len(t, plaintext, 32)
+
+	decrypted, err := p.DecryptDataKey(id, encrypted)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	_, err = p.DecryptDataKey("key2", encrypted)
+	require.Error(t, err)
+}
@@ -0,0 +1,279 @@
+package mantil
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// attrType is the entity type discriminator attribute.
+const attrType = "_type"
+
+// entityType describes Go type registered with WithEntity.
+type entityType struct {
+	name  string
+	typ   reflect.Type
+	parts []keyTemplatePart
+}
+
+// keyTemplatePart is a literal or a struct field in the key template.
+type keyTemplatePart struct {
+	literal string
+	field   string
+}
+
+// WithEntity registers Go struct type as the entity stored in the KV
+// partition. Many entity types can be stored in the same partition.
+//
+// Typ is the type discriminator stored with each item in the _type
+// attribute. KeyTemplate describes how the key is derived from the entity
+// fields. It is a composite key, see Key, where the {Field} parts are
+// replaced with the values of struct fields.
+// Items found by Find into []interface{} are decoded by the discriminator
+// into pointers to the registered types.
+// Example:
+//   kv, err := mantil.NewKV("shop",
+//   	mantil.WithEntity(Customer{}, "customer", "customer#{ID}"),
+//   	mantil.WithEntity(Order{}, "order", "customer#{CustomerID}#order#{ID}"),
+//   )
+//   err = kv.Save(&order)
+//   orders, iter, err := mantil.Query[Order](kv, customerID)
+//
+//   var items []interface{}
+//   _, err = kv.Find(&items, mantil.FindBeginsWith, mantil.Key("customer", customerID))
+//   for _, item := range items {
+//   	switch v := item.(type) {
+//   	case *Customer:
+//   	case *Order:
+//   	}
+//   }
+//
+func WithEntity(entity interface{}, typ, keyTemplate string) KVOption {
+	return func(k *KV) error {
+		t := reflect.TypeOf(entity)
+		if t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct {
+			return fmt.Errorf("entity must be a struct, got %T", entity)
+		}
+		if typ == "" {
+			return fmt.Errorf("entity %s type discriminator is required", t)
+		}
+		for _, e := range k.entities {
+			if e.name == typ {
+				return fmt.Errorf("entity type %s already registered for %s", typ, e.typ)
+			}
+			if e.typ == t {
+				return fmt.Errorf("entity %s already registered", t)
+			}
+		}
+		parts, err := parseKeyTemplate(t, keyTemplate)
+		if err != nil {
+			return err
+		}
+		k.entities = append(k.entities, entityType{name: typ, typ: t, parts: parts})
+		return nil
+	}
+}
+
+func parseKeyTemplate(t reflect.Type, template string) ([]keyTemplatePart, error) {
+	if template == "" {
+		return nil, fmt.Errorf("entity %s key template is required", t)
+	}
+	var parts []keyTemplatePart
+	hasField := false
+	for _, p := range strings.Split(template, KeySeparator) {
+		if !strings.HasPrefix(p, "{") || !strings.HasSuffix(p, "}") {
+			parts = append(parts, keyTemplatePart{literal: p})
+			continue
+		}
+		name := p[1 : len(p)-1]
+		f, ok := t.FieldByName(name)
+		if !ok || f.PkgPath != "" {
+			return nil, fmt.Errorf("entity %s has no exported field %s used in key template", t, name)
+		}
+		parts = append(parts, keyTemplatePart{field: name})
+		hasField = true
+	}
+	if !hasField {
+		return nil, fmt.Errorf("entity %s key template %s has no fields", t, template)
+	}
+	return parts, nil
+}
+
+// key derives entity key from the struct fields.
+func (e *entityType) key(v reflect.Value) (string, error) {
+	parts := make([]string, 0, len(e.parts))
+	for _, p := range e.parts {
+		if p.field == "" {
+			parts = append(parts, keyPart(p.literal))
+			continue
+		}
+		f := v.FieldByName(p.field)
+		if f.Kind() == reflect.String && f.String() == "" {
+			return "", fmt.Errorf("entity %s key field %s is empty", e.typ, p.field)
+		}
+		parts = append(parts, keyPart(f.Interface()))
+	}
+	return strings.Join(parts, KeySeparator), nil
+}
+
+// prefix builds key prefix from the values of the leading key fields.
+// Complete is true when values are provided for all key fields.
+func (e *entityType) prefix(values []interface{}) (prefix string, complete bool, err error) {
+	var parts []string
+	i := 0
+	for _, p := range e.parts {
+		if p.field == "" {
+			parts = append(parts, keyPart(p.literal))
+			continue
+		}
+		if i == len(values) {
+			return strings.Join(parts, KeySeparator), false, nil
+		}
+		parts = append(parts, keyPart(values[i]))
+		i++
+	}
+	if i < len(values) {
+		return "", false, fmt.Errorf("entity %s key has %d fields, got %d values", e.typ, i, len(values))
+	}
+	return strings.Join(parts, KeySeparator), true, nil
+}
+
+func (k *KV) entityByType(t reflect.Type) (*entityType, error) {
+	for i, e := range k.entities {
+		if e.typ == t {
+			return &k.entities[i], nil
+		}
+	}
+	return nil, fmt.Errorf("entity %s is not registered, use WithEntity", t)
+}
+
+func (k *KV) entityByName(name string) (*entityType, bool) {
+	for i, e := range k.entities {
+		if e.name == name {
+			return &k.entities[i], true
+		}
+	}
+	return nil, false
+}
+
+// entity returns registered type and struct value of the entity.
+func (k *KV) entity(entity interface{}) (*entityType, reflect.Value, error) {
+	v := reflect.ValueOf(entity)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, v, fmt.Errorf("entity must be a struct, got %T", entity)
+	}
+	e, err := k.entityByType(v.Type())
+	return e, v, err
+}
+
+// EntityKey returns key of the registered entity derived from its key
+// template.
+func (k *KV) EntityKey(entity interface{}) (string, error) {
+	e, v, err := k.entity(entity)
+	if err != nil {
+		return "", err
+	}
+	return e.key(v)
+}
+
+// Save puts registered entity into KV under the key derived from its key
+// template. Entity type discriminator is stored with the item.
+func (k *KV) Save(entity interface{}) error {
+	e, v, err := k.entity(entity)
+	if err != nil {
+		return err
+	}
+	key, err := e.key(v)
+	if err != nil {
+		return err
+	}
+	av, err := attributevalue.MarshalMap(entity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record, %w", err)
+	}
+	av[attrType] = &types.AttributeValueMemberS{Value: e.name}
+	return k.put(key, av)
+}
+
+// Load reads registered entity from KV. Entity must be a pointer with the
+// key template fields set, the rest of the fields are filled from KV.
+func (k *KV) Load(entity interface{}) error {
+	if v := reflect.ValueOf(entity); v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("entity must be a non-nil pointer, got %T", entity)
+	}
+	key, err := k.EntityKey(entity)
+	if err != nil {
+		return err
+	}
+	return k.Get(key, entity)
+}
+
+// Query finds entities of type T in KV. Args are values of the leading key
+// template fields, in the template order, followed by find options.
+// Without values returns all entities of the type. With values for all key
+// fields returns single entity.
+// Only items with the T type discriminator are returned, so the Limit
+// option applies to the read items before filtering by type.
+// Example:
+//   // all orders of the customer
+//   orders, iter, err := mantil.Query[Order](kv, customerID)
+//
+func Query[T any](k *KV, args ...interface{}) ([]T, *Iterator[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	e, err := k.entityByType(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	var values []interface{}
+	var opts []FindOption
+	for _, a := range args {
+		if o, ok := a.(FindOption); ok {
+			opts = append(opts, o)
+			continue
+		}
+		values = append(values, a)
+	}
+	prefix, complete, err := e.prefix(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts = append(opts, Where(attrType, "=", e.name))
+	kv := Typed[T](k)
+	switch {
+	case complete:
+		return kv.FindWith(FindBetween, []string{prefix, prefix}, opts...)
+	case prefix == "":
+		return kv.FindWith(FindAll, nil, opts...)
+	default:
+		return kv.FindWith(FindBeginsWith, []string{prefix + KeySeparator}, opts...)
+	}
+}
+
+// unmarshalEntity decodes item into the pointer to the registered entity
+// type found by the item type discriminator. Items without registered type
+// are decoded as map.
+func (k *KV) unmarshalEntity(av map[string]types.AttributeValue) (interface{}, error) {
+	if t, ok := av[attrType].(*types.AttributeValueMemberS); ok {
+		if e, ok := k.entityByName(t.Value); ok {
+			v := reflect.New(e.typ)
+			if err := attributevalue.UnmarshalMap(av, v.Interface()); err != nil {
+				return nil, err
+			}
+			return v.Interface(), nil
+		}
+	}
+	var m map[string]interface{}
+	if err := attributevalue.UnmarshalMap(av, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,136 @@
+package mantil
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+)
+
+type Customer struct {
+	ID   string
+	Name string
+}
+
+type CustomerOrder struct {
+	CustomerID string
+	No         int
+	Total      int
+}
+
+func entityTestKV(t *testing.T) *KV {
+	k := &KV{partition: "SHOP"}
+	require.NoError(t, WithEntity(Customer{}, "customer", "customer#{ID}")(k))
+	require.NoError(t, WithEntity(&CustomerOrder{}, "order", "customer#{CustomerID}#order#{No}")(k))
+	return k
+}
+
+func TestWithEntity(t *testing.T) {
+	k := entityTestKV(t)
+	require.Error(t, WithEntity(Customer{}, "other", "other#{ID}")(k))
+	require.Error(t, WithEntity(Task{}, "customer", "task#{ID}")(k))
+	require.Error(t, WithEntity(Task{}, "task", "task#{Missing}")(k))
+	require.Error(t, WithEntity(Task{}, "task", "task")(k))
+	require.Error(t, WithEntity(Task{}, "", "task#{ID}")(k))
+	require.Error(t, WithEntity("task", "task", "task#{ID}")(k))
+
+	key, err := k.EntityKey(&CustomerOrder{CustomerID: "c#1", No: 2})
+	require.NoError(t, err)
+	require.Equal(t, Key("customer", "c#1", "order", 2), key)
+	_, err = k.EntityKey(Customer{})
+	require.Error(t, err)
+	_, err = k.EntityKey(Task{ID: "1"})
+	require.Error(t, err)
+
+	e, err := k.entityByType(reflect.TypeOf(CustomerOrder{}))
+	require.NoError(t, err)
+	prefix, complete, err := e.prefix(nil)
+	require.NoError(t, err)
+	require.False(t, complete)
+	require.Equal(t, "customer", prefix)
+	prefix, complete, err = e.prefix([]interface{}{"1"})
+	require.NoError(t, err)
+	require.False(t, complete)
+	require.Equal(t, "customer#1#order", prefix)
+	prefix, complete, err = e.prefix([]interface{}{"1", 2})
+	require.NoError(t, err)
+	require.True(t, complete)
+	require.Equal(t, Key("customer", "1", "order", 2), prefix)
+	_, _, err = e.prefix([]interface{}{"1", 2, 3})
+	require.Error(t, err)
+}
+
+func TestUnmarshalEntities(t *testing.T) {
+	k := entityTestKV(t)
+	require.NoError(t, WithEncryption(testKeyProvider(t, "key1"))(k))
+
+	var items []map[string]types.AttributeValue
+	for _, v := range []interface{}{Customer{ID: "1", Name: "Ivan"}, CustomerOrder{CustomerID: "1", No: 1, Total: 42}} {
+		e, rv, err := k.entity(v)
+		require.NoError(t, err)
+		key, err := e.key(rv)
+		require.NoError(t, err)
+		av, err := attributevalue.MarshalMap(v)
+		require.NoError(t, err)
+		av[attrType] = &types.AttributeValueMemberS{Value: e.name}
+		item, err := k.marshalItem(key, av)
+		require.NoError(t, err)
+		// type is stored in clear
+		require.NotNil(t, item[attrValue])
+		require.Equal(t, &types.AttributeValueMemberS{Value: e.name}, item[attrType])
+		items = append(items, item)
+	}
+	plain, err := k.marshal("other", Task{ID: "2"})
+	require.NoError(t, err)
+	items = append(items, plain)
+
+	var entities []interface{}
+	require.NoError(t, k.unmarshal(&entities, items))
+	require.Len(t, entities, 3)
+	require.Equal(t, &Customer{ID: "1", Name: "Ivan"}, entities[0])
+	require.Equal(t, &CustomerOrder{CustomerID: "1", No: 1, Total: 42}, entities[1])
+	require.IsType(t, map[string]interface{}{}, entities[2])
+
+	var entity interface{}
+	require.NoError(t, k.unmarshalItem(items[1], &entity))
+	require.Equal(t, &CustomerOrder{CustomerID: "1", No: 1, Total: 42}, entity)
+}
+
+func TestKVEntities(t *testing.T) {
+	kv, err := NewKV("SHOP",
+		WithEntity(Customer{}, "customer", "customer#{ID}"),
+		WithEntity(CustomerOrder{}, "order", "customer#{CustomerID}#order#{No}"),
+	)
+	require.NoError(t, err)
+	require.NoError(t, kv.DeleteAll())
+
+	require.NoError(t, kv.Save(&Customer{ID: "1", Name: "Ivan"}))
+	require.NoError(t, kv.Save(Customer{ID: "2", Name: "Daniel"}))
+	for no := 1; no <= 3; no++ {
+		require.NoError(t, kv.Save(&CustomerOrder{CustomerID: "1", No: no, Total: no * 10}))
+	}
+
+	c := Customer{ID: "1"}
+	require.NoError(t, kv.Load(&c))
+	require.Equal(t, "Ivan", c.Name)
+	require.Error(t, kv.Load(c))
+
+	orders, _, err := Query[CustomerOrder](kv, "1")
+	require.NoError(t, err)
+	require.Len(t, orders, 3)
+	orders, _, err = Query[CustomerOrder](kv, "1", 2)
+	require.NoError(t, err)
+	require.Equal(t, []CustomerOrder{{CustomerID: "1", No: 2, Total: 20}}, orders)
+	customers, _, err := Query[Customer](kv)
+	require.NoError(t, err)
+	require.Len(t, customers, 2)
+
+	var items []interface{}
+	_, err = kv.Find(&items, FindBeginsWith, Key("customer", "1"))
+	require.NoError(t, err)
+	require.Len(t, items, 4)
+	require.IsType(t, &Customer{}, items[0])
+	require.IsType(t, &CustomerOrder{}, items[1])
+}
@@ -0,0 +1,206 @@
+package mantil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// number of items written in a single import batch
+const importBatchSize = 100
+
+// exportRecord is a single line of the export.
+// Value is in DynamoDB JSON format so all attribute types are preserved.
+type exportRecord struct {
+	Partition string          `json:"partition"`
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// Export writes all items of the KV partition to w as JSON lines.
+// Each line holds partition, key and value of a single item. Values are
+// exported decoded; decompressed, decrypted and read from S3 if offloaded.
+// Example:
+//   {"partition":"TODOS","key":"1","value":{"ID":{"S":"1"},"Done":{"BOOL":true}}}
+//
+func (k *KV) Export(w io.Writer) error {
+	keyCondition, expressionAttributes, _ := k.findConditions(FindAll)
+	input := k.queryInput(keyCondition, expressionAttributes)
+	enc := json.NewEncoder(w)
+	for {
+		out, err := k.dynamo.client.Query(context.TODO(), input)
+		if err != nil {
+			return err
+		}
+		if err := k.export(enc, out.Items); err != nil {
+			return err
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// ExportAll writes items of all partitions in the KV table to w.
+// Format is the same as in Export. Items are decoded with the options of
+// this KV, encrypted values of other partitions must use the same key
+// provider. Index attributes are removed only for the indexes declared on
+// this KV, other partitions should use the same indexes.
+func (k *KV) ExportAll(w io.Writer) error {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(k.tableName),
+	}
+	enc := json.NewEncoder(w)
+	for {
+		out, err := k.dynamo.client.Scan(context.TODO(), input)
+		if err != nil {
+			return err
+		}
+		if err := k.export(enc, out.Items); err != nil {
+			return err
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+func (k *KV) export(enc *json.Encoder, items []map[string]types.AttributeValue) error {
+	for _, item := range items {
+		r, err := k.exportRecord(item)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportRecord decodes item and strips key attributes from the value.
+func (k *KV) exportRecord(item map[string]types.AttributeValue) (*exportRecord, error) {
+	it, err := k.scanItem(item)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := encodeItem(k.exportAttributes(it.value))
+	if err != nil {
+		return nil, err
+	}
+	return &exportRecord{
+		Partition: it.Partition,
+		Key:       it.Key,
+		Value:     buf,
+	}, nil
+}
+
+// exportAttributes removes key, internal and index attributes of the KV
+// indexes from the decoded item. Index attributes are created again on
+// import with the importing KV indexes. Other attributes are user fields and
+// are exported, regardless of the name.
+func (k *KV) exportAttributes(av map[string]types.AttributeValue) map[string]types.AttributeValue {
+	delete(av, PK)
+	delete(av, SK)
+	for _, name := range internalAttributes {
+		delete(av, name)
+	}
+	for _, i := range k.indexes {
+		delete(av, i.pkName())
+		delete(av, i.skName())
+	}
+	return av
+}
+
+// Import reads JSON lines created by Export or ExportAll from r and writes
+// them into the KV partition, regardless of the partition they were exported
+// from. Existing items with the same keys are replaced.
+// Values are encoded with the KV options: indexes, compression, encryption
+// and offload to S3.
+func (k *KV) Import(r io.Reader) error {
+	return k.importRecords(r, false)
+}
+
+// ImportAll reads JSON lines created by Export or ExportAll from r and
+// writes each item into the partition it was exported from.
+func (k *KV) ImportAll(r io.Reader) error {
+	return k.importRecords(r, true)
+}
+
+func (k *KV) importRecords(r io.Reader, keepPartition bool) error {
+	dec := json.NewDecoder(r)
+	var batch []exportRecord
+	for {
+		var rec exportRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read import record, %w", err)
+		}
+		if !keepPartition {
+			rec.Partition = k.partition
+		}
+		batch = append(batch, rec)
+		if len(batch) == importBatchSize {
+			if err := k.importBatch(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	return k.importBatch(batch)
+}
+
+// importBatch writes records grouped by partition.
+func (k *KV) importBatch(records []exportRecord) error {
+	var partitions []string
+	keys := make(map[string][]string)
+	avs := make(map[string][]map[string]types.AttributeValue)
+	// position of the key in the partition batch, batch write doesn't
+	// allow duplicate keys so the last record wins
+	pos := make(map[[2]string]int)
+	for _, rec := range records {
+		if rec.Key == "" {
+			return fmt.Errorf("import record without key")
+		}
+		av, err := decodeItem(rec.Value)
+		if err != nil {
+			return fmt.Errorf("failed to decode value of %s/%s, %w", rec.Partition, rec.Key, err)
+		}
+		if i, ok := pos[[2]string{rec.Partition, rec.Key}]; ok {
+			avs[rec.Partition][i] = av
+			continue
+		}
+		if _, ok := keys[rec.Partition]; !ok {
+			partitions = append(partitions, rec.Partition)
+		}
+		pos[[2]string{rec.Partition, rec.Key}] = len(keys[rec.Partition])
+		keys[rec.Partition] = append(keys[rec.Partition], rec.Key)
+		avs[rec.Partition] = append(avs[rec.Partition], av)
+	}
+	for _, p := range partitions {
+		if err := k.onPartition(p).putMany(keys[p], avs[p]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onPartition returns KV with the same options for another partition.
+func (k *KV) onPartition(partition string) *KV {
+	if partition == k.partition {
+		return k
+	}
+	kp := *k
+	kp.partition = partition
+	return &kp
+}
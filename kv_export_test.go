@@ -0,0 +1,123 @@
+package mantil
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportRecord(t *testing.T) {
+	k := &KV{partition: "TODOS"}
+	require.NoError(t, WithIndex("byStatus", "Status", "")(k))
+	require.NoError(t, WithCompression()(k))
+
+	task := Task{ID: "1", Status: "done", Due: strings.Repeat("2021-10-01 ", 1000)}
+	item, err := k.marshal("1", task)
+	require.NoError(t, err)
+	require.NotNil(t, item[attrCompressed])
+
+	r, err := k.exportRecord(item)
+	require.NoError(t, err)
+	require.Equal(t, "TODOS", r.Partition)
+	require.Equal(t, "1", r.Key)
+
+	var value map[string]interface{}
+	require.NoError(t, json.Unmarshal(r.Value, &value))
+	require.Len(t, value, 3)
+	require.Equal(t, map[string]interface{}{"S": "done"}, value["Status"])
+
+	// value is stored with the importing KV options
+	av, err := decodeItem(r.Value)
+	require.NoError(t, err)
+	k.compress = false
+	imported, err := k.marshalItem(r.Key, av)
+	require.NoError(t, err)
+	require.Nil(t, imported[attrCompressed])
+	var got Task
+	require.NoError(t, k.unmarshalItem(imported, &got))
+	require.Equal(t, task, got)
+	require.Equal(t, item["byStatus_PK"], imported["byStatus_PK"])
+}
+
+func TestExportRecordOtherPartition(t *testing.T) {
+	// item of another partition with the same index
+	other := &KV{partition: "OTHER"}
+	require.NoError(t, WithIndex("byDue", "Due", "")(other))
+	item, err := other.marshal("1", Task{ID: "1", Due: "2021-10-01"})
+	require.NoError(t, err)
+	require.NotNil(t, item["byDue_PK"])
+
+	k := &KV{partition: "TODOS"}
+	require.NoError(t, WithIndex("byDue", "Due", "")(k))
+	r, err := k.exportRecord(item)
+	require.NoError(t, err)
+	require.Equal(t, "OTHER", r.Partition)
+	var value map[string]interface{}
+	require.NoError(t, json.Unmarshal(r.Value, &value))
+	require.Len(t, value, 3)
+	require.Nil(t, value["byDue_PK"])
+	require.Nil(t, value["byDue_SK"])
+}
+
+func TestExportRecordUserAttributes(t *testing.T) {
+	type owned struct {
+		ID      string `dynamodbav:"_id"`
+		OwnerPK string `dynamodbav:"Owner_PK"`
+		Status  string
+	}
+	k := &KV{partition: "OWNED"}
+	require.NoError(t, WithIndex("byStatus", "Status", "")(k))
+	v := owned{ID: "1", OwnerPK: "owner", Status: "open"}
+	item, err := k.marshal("1", v)
+	require.NoError(t, err)
+
+	r, err := k.exportRecord(item)
+	require.NoError(t, err)
+	var value map[string]interface{}
+	require.NoError(t, json.Unmarshal(r.Value, &value))
+	require.Len(t, value, 3)
+	require.Nil(t, value["byStatus_PK"])
+
+	av, err := decodeItem(r.Value)
+	require.NoError(t, err)
+	imported, err := k.marshalItem(r.Key, av)
+	require.NoError(t, err)
+	var got owned
+	require.NoError(t, k.unmarshalItem(imported, &got))
+	require.Equal(t, v, got)
+}
+
+func TestKVExportImport(t *testing.T) {
+	src, err := NewKV("EXPORT")
+	require.NoError(t, err)
+	require.NoError(t, src.DeleteAll())
+	dst, err := NewKV("IMPORT")
+	require.NoError(t, err)
+	require.NoError(t, dst.DeleteAll())
+
+	tasks := map[string]Task{
+		"1": {ID: "1", Status: "open"},
+		"2": {ID: "2", Status: "done"},
+	}
+	require.NoError(t, src.PutMany(tasks))
+
+	var buf bytes.Buffer
+	require.NoError(t, src.Export(&buf))
+	require.Equal(t, 2, strings.Count(buf.String(), "\n"))
+
+	require.NoError(t, dst.Import(bytes.NewReader(buf.Bytes())))
+	var got []Task
+	_, err = dst.FindAll(&got)
+	require.NoError(t, err)
+	require.Equal(t, []Task{tasks["1"], tasks["2"]}, got)
+
+	// import into exported partition
+	require.NoError(t, src.DeleteAll())
+	require.NoError(t, dst.ImportAll(bytes.NewReader(buf.Bytes())))
+	_, err = src.FindAll(&got)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+}
@@ -0,0 +1,134 @@
+package mantil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Condition is a predicate on the item attribute.
+// Create it with Where, AttributeExists or AttributeNotExists.
+type Condition struct {
+	attribute string
+	op        string
+	value     interface{}
+}
+
+// Where creates condition which compares item attribute with the value.
+// Supported operators are: =, <>, <, <=, >, >=, begins_with and contains.
+// Example:
+//   mantil.Where("Stock", ">", 0)
+//
+func Where(attribute, op string, value interface{}) Condition {
+	return Condition{
+		attribute: attribute,
+		op:        op,
+		value:     value,
+	}
+}
+
+// AttributeExists creates condition which is satisfied when item has attribute.
+func AttributeExists(attribute string) Condition {
+	return Condition{attribute: attribute, op: "attribute_exists"}
+}
+
+// AttributeNotExists creates condition which is satisfied when item doesn't
+// have attribute. Use AttributeNotExists(mantil.SK) to check that the item
+// doesn't exist.
+func AttributeNotExists(attribute string) Condition {
+	return Condition{attribute: attribute, op: "attribute_not_exists"}
+}
+
+// expression collects attribute names and values placeholders while
+// building DynamoDB expressions.
+type expression struct {
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+func newExpression() *expression {
+	return &expression{
+		names:  make(map[string]string),
+		values: make(map[string]types.AttributeValue),
+	}
+}
+
+func (e *expression) name(attribute string) string {
+	for k, v := range e.names {
+		if v == attribute {
+			return k
+		}
+	}
+	ph := fmt.Sprintf("#n%d", len(e.names))
+	e.names[ph] = attribute
+	return ph
+}
+
+func (e *expression) value(v interface{}) (string, error) {
+	av, err := attributevalue.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal expression value, %w", err)
+	}
+	ph := fmt.Sprintf(":v%d", len(e.values))
+	e.values[ph] = av
+	return ph, nil
+}
+
+func (e *expression) condition(c Condition) (string, error) {
+	if c.attribute == "" {
+		return "", fmt.Errorf("condition attribute name is required")
+	}
+	name := e.name(c.attribute)
+	switch c.op {
+	case "attribute_exists", "attribute_not_exists":
+		return fmt.Sprintf("%s(%s)", c.op, name), nil
+	case "=", "<>", "<", "<=", ">", ">=":
+		value, err := e.value(c.value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", name, c.op, value), nil
+	case "begins_with", "contains":
+		value, err := e.value(c.value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s(%s, %s)", c.op, name, value), nil
+	default:
+		return "", fmt.Errorf("unknown condition operator %s", c.op)
+	}
+}
+
+// conditions joins conditions with AND.
+// Returns empty string when there are no conditions.
+func (e *expression) conditions(conds []Condition) (string, error) {
+	var parts []string
+	for _, c := range conds {
+		p, err := e.condition(c)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, " AND "), nil
+}
+
+// attributeNames returns names map in the form expected by DynamoDB input
+// structs, nil if there are no names.
+func (e *expression) attributeNames() map[string]string {
+	if len(e.names) == 0 {
+		return nil
+	}
+	return e.names
+}
+
+// attributeValues returns values map in the form expected by DynamoDB input
+// structs, nil if there are no values.
+func (e *expression) attributeValues() map[string]types.AttributeValue {
+	if len(e.values) == 0 {
+		return nil
+	}
+	return e.values
+}
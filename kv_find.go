@@ -0,0 +1,113 @@
+package mantil
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// FindOption modifies Find query, see FindWith.
+type FindOption interface {
+	applyFind(*findOptions)
+}
+
+type findOptions struct {
+	desc       bool
+	limit      int
+	projection []string
+	filters    []Condition
+	cursor     string
+}
+
+type findOptionFunc func(*findOptions)
+
+func (f findOptionFunc) applyFind(o *findOptions) {
+	f(o)
+}
+
+// Desc returns items in descending key order.
+func Desc() FindOption {
+	return findOptionFunc(func(o *findOptions) {
+		o.desc = true
+	})
+}
+
+// Limit sets maximum number of items evaluated in a single page.
+// Use FindIterator to get following pages. When used with Where conditions
+// page can contain fewer items because filtering is done after limit is
+// applied.
+func Limit(n int) FindOption {
+	return findOptionFunc(func(o *findOptions) {
+		o.limit = n
+	})
+}
+
+// Project returns only selected attributes of the items.
+// Other attributes are left with zero values.
+func Project(attributes ...string) FindOption {
+	return findOptionFunc(func(o *findOptions) {
+		o.projection = append(o.projection, attributes...)
+	})
+}
+
+// applyFind makes Condition usable as find option. Items which don't satisfy
+// condition are filtered out of the Find results. When values are packed by
+// compression, encryption or offload to S3 only indexed attributes can be
+// used.
+func (c Condition) applyFind(o *findOptions) {
+	o.filters = append(o.filters, c)
+}
+
+func newFindOptions(opts []FindOption) findOptions {
+	var o findOptions
+	for _, opt := range opts {
+		opt.applyFind(&o)
+	}
+	return o
+}
+
+// apply sets options to the query input.
+func (o findOptions) apply(k *KV, input *dynamodb.QueryInput) error {
+	if o.cursor != "" {
+		key, err := k.parseCursor(o.cursor, aws.ToString(input.IndexName))
+		if err != nil {
+			return err
+		}
+		input.ExclusiveStartKey = key
+	}
+	if o.desc {
+		input.ScanIndexForward = aws.Bool(false)
+	}
+	if o.limit > 0 {
+		input.Limit = aws.Int32(int32(o.limit))
+	}
+	e := newExpression()
+	if len(o.projection) > 0 {
+		var names []string
+		for _, p := range o.projection {
+			names = append(names, e.name(p))
+		}
+		// packed values are needed to get any of the value attributes
+		// keys are needed for decryption
+		if k.compress || k.s3 != nil || k.encryption != nil {
+			for _, p := range append(internalAttributes, PK, SK) {
+				names = append(names, e.name(p))
+			}
+		}
+		input.ProjectionExpression = aws.String(strings.Join(names, ", "))
+	}
+	if err := k.checkConditions(o.filters); err != nil {
+		return err
+	}
+	filter, err := e.conditions(o.filters)
+	if err != nil {
+		return err
+	}
+	input.FilterExpression = nilIfEmpty(filter)
+	input.ExpressionAttributeNames = e.attributeNames()
+	for k, v := range e.values {
+		input.ExpressionAttributeValues[k] = v
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package mantil
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// kvIndex is a secondary index declared in NewKV.
+// It is stored as a global secondary index on the kv table. Partition key of
+// the index is the partition name combined with the attribute value, so each
+// KV partition has independent set of index values.
+type kvIndex struct {
+	name          string
+	attribute     string
+	sortAttribute string
+}
+
+// names of the index key attributes in the kv table
+func (i kvIndex) pkName() string { return i.name + "_PK" }
+func (i kvIndex) skName() string { return i.name + "_SK" }
+
+var indexNameRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{2,}$`)
+
+// WithIndex declares secondary index on the attribute of the stored values.
+// Index can be queried with FindByIndex.
+//
+// If sortAttribute is empty index is sorted by the item key. Otherwise by the
+// value of sortAttribute. Items without attribute, or sortAttribute when
+// specified, or with empty string values are not included in the index.
+//
+// Name must start with a letter and contain at least three letters, digits
+// or underscores. Index is created on the kv table on first usage. NewKV
+// doesn't wait for the index creation on the existing table, FindByIndex
+// returns ErrIndexNotActive until the index is backfilled.
+// Example:
+//   kv, err := mantil.NewKV("todos", mantil.WithIndex("byStatus", "Status", "CreatedAt"))
+//
+func WithIndex(name, attribute, sortAttribute string) KVOption {
+	return func(k *KV) error {
+		if !indexNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid index name %s", name)
+		}
+		if attribute == "" {
+			return fmt.Errorf("index %s attribute is required", name)
+		}
+		for _, i := range k.indexes {
+			if i.name == name {
+				return fmt.Errorf("index %s already declared", name)
+			}
+		}
+		k.indexes = append(k.indexes, kvIndex{
+			name:          name,
+			attribute:     attribute,
+			sortAttribute: sortAttribute,
+		})
+		return nil
+	}
+}
+
+func (k *KV) globalIndexes() []TableIndex {
+	var gis []TableIndex
+	for _, i := range k.indexes {
+		gis = append(gis, TableIndex{
+			Name:         i.name,
+			PartitionKey: TableKey{Name: i.pkName()},
+			SortKey:      TableKey{Name: i.skName()},
+		})
+	}
+	return gis
+}
+
+func (k *KV) index(name string) (kvIndex, bool) {
+	for _, i := range k.indexes {
+		if i.name == name {
+			return i, true
+		}
+	}
+	return kvIndex{}, false
+}
+
+// indexPartition returns value of the index partition key for the attribute value.
+func (k *KV) indexPartition(value string) string {
+	return k.partition + "#" + value
+}
+
+// setIndexAttributes adds index key attributes, calculated from value
+// attributes av, to the item.
+func (k *KV) setIndexAttributes(key string, av, item map[string]types.AttributeValue) {
+	for _, i := range k.indexes {
+		pk, ok := indexValue(av[i.attribute])
+		if !ok {
+			continue
+		}
+		sk := key
+		if i.sortAttribute != "" {
+			if sk, ok = indexValue(av[i.sortAttribute]); !ok {
+				continue
+			}
+		}
+		item[i.pkName()] = &types.AttributeValueMemberS{Value: k.indexPartition(pk)}
+		item[i.skName()] = &types.AttributeValueMemberS{Value: sk}
+	}
+}
+
+// indexValue returns string representation of scalar attribute value.
+// Empty strings are not valid index keys in DynamoDB.
+func indexValue(av types.AttributeValue) (string, bool) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value, v.Value != ""
+	case *types.AttributeValueMemberN:
+		return v.Value, true
+	case *types.AttributeValueMemberBOOL:
+		return strconv.FormatBool(v.Value), true
+	default:
+		return "", false
+	}
+}
+
+// FindByIndex searches KV by the secondary index declared in NewKV.
+// First argument is the value of the indexed attribute. Operation and the
+// rest of arguments are applied to the index sort attribute, or to the item
+// key if the index doesn't have sort attribute.
+// Example:
+//   // all todos with status done
+//   iter, err := kv.FindByIndex("byStatus", &todos, FindAll, "done")
+//   // todos with status done created in 2021
+//   iter, err := kv.FindByIndex("byStatus", &todos, FindBeginsWith, "done", "2021-")
+//
+func (k *KV) FindByIndex(index string, items interface{}, op FindOperator, args ...string) (*FindIterator, error) {
+	return k.FindByIndexWith(index, items, op, args)
+}
+
+// FindByIndexWith is FindByIndex with find options, see FindWith.
+func (k *KV) FindByIndexWith(index string, items interface{}, op FindOperator, keys []string, opts ...FindOption) (*FindIterator, error) {
+	i, ok := k.index(index)
+	if !ok {
+		return nil, fmt.Errorf("index %s not found", index)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("index %s attribute value is required", index)
+	}
+	if err := k.dynamo.ensureIndexActive(k.tableName, i.name); err != nil {
+		return nil, err
+	}
+	keyCondition, expressionAttributes, err := keyConditions(i.pkName(), k.indexPartition(keys[0]), i.skName(), op, keys[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	input := k.queryInput(keyCondition, expressionAttributes)
+	input.IndexName = aws.String(i.name)
+	if err := newFindOptions(opts).apply(k, input); err != nil {
+		return nil, err
+	}
+	return k.find(items, input)
+}
+
+// valueAttributes removes primary key and index attributes from the decoded
+// item.
+func (k *KV) valueAttributes(av map[string]types.AttributeValue) map[string]types.AttributeValue {
+	delete(av, PK)
+	delete(av, SK)
+	for _, i := range k.indexes {
+		delete(av, i.pkName())
+		delete(av, i.skName())
+	}
+	return av
+}
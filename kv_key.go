@@ -0,0 +1,168 @@
+package mantil
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeySeparator separates parts of the composite key.
+const KeySeparator = "#"
+
+// keyTimeLayout is RFC3339 with fixed number of fractional digits so the
+// times are ordered same as their string representations.
+const keyTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// Separator is escaped with the quote character, which sorts just before it:
+// quote as two quotes and separator as quote followed by $, which sorts just
+// after it. Escaped parts have the same order as the raw values.
+var (
+	keyEscaper   = strings.NewReplacer(`"`, `""`, KeySeparator, `"$`)
+	keyUnescaper = strings.NewReplacer(`""`, `"`, `"$`, KeySeparator)
+)
+
+// Key builds composite KV key from parts joined with the KeySeparator.
+// String parts are escaped so they can contain separator, escaping keeps
+// their order. Numbers and times are encoded with IntKey, UintKey, FloatKey
+// and TimeKey so that their string order is the same as the natural order.
+// Other values are formatted with fmt.Sprint.
+//
+// Keys are ordered by the parts, except when a string part is a prefix of
+// the other and the rest starts with a character which is not after the
+// separator: control characters, space, !, " or the separator itself. For
+// example Key("a!") and Key("a#") are before Key("a", "b").
+// Example:
+//   key := mantil.Key("user", 123, "order", time.Now())
+//   // user#00000000000000000123#order#2021-10-01T12:30:00.000000000Z
+//
+//   // all orders of the user
+//   iter, err := kv.Find(&orders, mantil.FindChildren, mantil.Key("user", 123, "order"))
+//
+func Key(parts ...interface{}) string {
+	encoded := make([]string, 0, len(parts))
+	for _, p := range parts {
+		encoded = append(encoded, keyPart(p))
+	}
+	return strings.Join(encoded, KeySeparator)
+}
+
+// ParseKey splits key created with Key into unescaped parts.
+func ParseKey(key string) []string {
+	parts := strings.Split(key, KeySeparator)
+	for i, p := range parts {
+		parts[i] = keyUnescaper.Replace(p)
+	}
+	return parts
+}
+
+func keyPart(p interface{}) string {
+	switch v := p.(type) {
+	case string:
+		return keyEscaper.Replace(v)
+	case int:
+		return IntKey(int64(v))
+	case int8:
+		return IntKey(int64(v))
+	case int16:
+		return IntKey(int64(v))
+	case int32:
+		return IntKey(int64(v))
+	case int64:
+		return IntKey(v)
+	case uint:
+		return UintKey(uint64(v))
+	case uint8:
+		return UintKey(uint64(v))
+	case uint16:
+		return UintKey(uint64(v))
+	case uint32:
+		return UintKey(uint64(v))
+	case uint64:
+		return UintKey(v)
+	case float32:
+		return FloatKey(float64(v))
+	case float64:
+		return FloatKey(v)
+	case time.Time:
+		return TimeKey(v)
+	default:
+		return keyEscaper.Replace(fmt.Sprint(v))
+	}
+}
+
+// IntKey encodes integer as the key which preserves numeric order in
+// string comparisons. Non negative integers are 20 digits zero padded
+// numbers. Negative are prefixed with minus, which sorts before digits, and
+// offset so that smaller numbers have smaller encoding.
+// Example:
+//   mantil.IntKey(42) // 00000000000000000042
+//   mantil.IntKey(-1) // -9223372036854775807
+//
+func IntKey(v int64) string {
+	if v >= 0 {
+		return UintKey(uint64(v))
+	}
+	return fmt.Sprintf("-%019d", uint64(v)+1<<63)
+}
+
+// ParseIntKey decodes key created with IntKey.
+func ParseIntKey(key string) (int64, error) {
+	if strings.HasPrefix(key, "-") {
+		u, err := strconv.ParseUint(key[1:], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return int64(u - 1<<63), nil
+	}
+	return strconv.ParseInt(key, 10, 64)
+}
+
+// UintKey encodes unsigned integer as 20 digits zero padded number.
+func UintKey(v uint64) string {
+	return fmt.Sprintf("%020d", v)
+}
+
+// FloatKey encodes float as 16 hex digits key which preserves numeric order
+// in string comparisons. Sign bit of the positive numbers is flipped, and
+// all bits of the negative numbers, so the IEEE 754 bits order is the same
+// as the numeric order.
+func FloatKey(v float64) string {
+	bits := math.Float64bits(v)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits ^= 1 << 63
+	}
+	return fmt.Sprintf("%016x", bits)
+}
+
+// ParseFloatKey decodes key created with FloatKey.
+func ParseFloatKey(key string) (float64, error) {
+	bits, err := strconv.ParseUint(key, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	if bits&(1<<63) != 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits), nil
+}
+
+// TimeKey encodes time as RFC3339 key in UTC with nanoseconds precision.
+// Fixed number of fractional digits preserves time order in string
+// comparisons.
+// Example:
+//   mantil.TimeKey(t) // 2021-10-01T12:30:00.000000000Z
+//
+func TimeKey(t time.Time) string {
+	return t.UTC().Format(keyTimeLayout)
+}
+
+// ParseTimeKey decodes key created with TimeKey.
+func ParseTimeKey(key string) (time.Time, error) {
+	return time.Parse(keyTimeLayout, key)
+}
@@ -0,0 +1,165 @@
+package mantil
+
+import (
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	ts := time.Date(2021, 10, 1, 14, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	require.Equal(t, "user#00000000000000000123#order#2021-10-01T12:30:00.000000000Z", Key("user", 123, "order", ts))
+	require.Equal(t, `a"$b#c""d#true`, Key("a#b", `c"d`, true))
+	require.Equal(t, []string{"a#b", `c"d`, "true"}, ParseKey(Key("a#b", `c"d`, true)))
+	require.Equal(t, []string{`"$`, `""#`, "%23"}, ParseKey(Key(`"$`, `""#`, "%23")))
+}
+
+func TestKeyEscapeOrder(t *testing.T) {
+	parts := []string{"", "!", `"`, `""`, `"#`, `"$`, "#", `#"`, "##", "#$", "$", "a", `a"`, "a#", "a#b", "a$", "b"}
+	require.True(t, sort.StringsAreSorted(parts))
+	var keys []string
+	for _, p := range parts {
+		keys = append(keys, Key(p))
+		require.Equal(t, []string{p}, ParseKey(Key(p)))
+	}
+	require.True(t, sort.StringsAreSorted(keys), keys)
+
+	// composite keys are ordered by parts
+	require.Less(t, Key("a", "z"), Key("a$"))
+	// documented exception, rest of the part is not after separator
+	require.Less(t, Key("a!"), Key("a", "b"))
+	require.Less(t, Key("a#"), Key("a", "b"))
+}
+
+func TestKeyOrder(t *testing.T) {
+	ints := []int64{math.MinInt64, -1000, -10, -2, -1, 0, 1, 2, 10, 1000, math.MaxInt64}
+	var keys []string
+	for _, i := range ints {
+		keys = append(keys, Key(i))
+	}
+	require.True(t, sort.StringsAreSorted(keys), keys)
+	require.Less(t, Key(uint64(math.MaxInt64)), Key(uint64(math.MaxUint64)))
+
+	base := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	times := []time.Time{base, base.Add(time.Nanosecond), base.Add(time.Millisecond), base.Add(time.Second), base.Add(24 * time.Hour)}
+	keys = nil
+	for _, ts := range times {
+		keys = append(keys, Key(ts))
+	}
+	require.True(t, sort.StringsAreSorted(keys), keys)
+}
+
+func TestChildrenKeyConditions(t *testing.T) {
+	prefix := Key("user", 1, "order")
+	cond, attrs, err := keyConditions(PK, "ORDERS", SK, FindChildren, prefix)
+	require.NoError(t, err)
+	require.Equal(t, "PK=:PK and begins_with (SK, :begins_with)", cond)
+	require.Equal(t, &types.AttributeValueMemberS{Value: prefix + "#"}, attrs[":begins_with"])
+
+	_, _, err = keyConditions(PK, "ORDERS", SK, FindChildrenBetween, prefix, "1")
+	require.Error(t, err)
+	cond, attrs, err = keyConditions(PK, "ORDERS", SK, FindChildrenBetween, prefix, Key(2), Key(5))
+	require.NoError(t, err)
+	require.Equal(t, "PK=:PK and SK BETWEEN :start and :end", cond)
+	require.Equal(t, &types.AttributeValueMemberS{Value: Key("user", 1, "order", 2)}, attrs[":start"])
+	require.Equal(t, &types.AttributeValueMemberS{Value: Key("user", 1, "order", 5)}, attrs[":end"])
+}
+
+func TestKVFindChildren(t *testing.T) {
+	kv, err := NewKV("CHILDREN")
+	require.NoError(t, err)
+	require.NoError(t, kv.DeleteAll())
+
+	for _, user := range []int{1, 2, 10} {
+		for _, order := range []int{1, 2, 3, 10} {
+			require.NoError(t, kv.Put(Key("user", user, "order", order), Task{ID: Key(user, order)}))
+		}
+	}
+
+	var tasks []Task
+	_, err = kv.Find(&tasks, FindChildren, Key("user", 1, "order"))
+	require.NoError(t, err)
+	require.Len(t, tasks, 4)
+	require.Equal(t, Key(1, 10), tasks[3].ID)
+
+	_, err = kv.Find(&tasks, FindChildrenBetween, Key("user", 10, "order"), Key(2), Key(10))
+	require.NoError(t, err)
+	require.Len(t, tasks, 3)
+	require.Equal(t, Key(10, 2), tasks[0].ID)
+}
+
+func TestKeyEncoders(t *testing.T) {
+	for _, i := range []int64{math.MinInt64, -42, -1, 0, 1, 42, math.MaxInt64} {
+		d, err := ParseIntKey(IntKey(i))
+		require.NoError(t, err)
+		require.Equal(t, i, d)
+	}
+	require.Equal(t, "-9223372036854775807", IntKey(-1))
+
+	floats := []float64{math.Inf(-1), -1e10, -2.5, -1, -0.001, 0, 0.001, 1, 2.5, 10, 1e10, math.Inf(1)}
+	var keys []string
+	for _, f := range floats {
+		keys = append(keys, FloatKey(f))
+		d, err := ParseFloatKey(FloatKey(f))
+		require.NoError(t, err)
+		require.Equal(t, f, d)
+	}
+	require.True(t, sort.StringsAreSorted(keys), keys)
+	require.Equal(t, FloatKey(2.5), Key(2.5))
+
+	ts := time.Date(2021, 10, 1, 12, 30, 0, 42, time.UTC)
+	d, err := ParseTimeKey(TimeKey(ts))
+	require.NoError(t, err)
+	require.True(t, ts.Equal(d))
+}
+
+func TestNewKeyID(t *testing.T) {
+	g := &keyIDGenerator{}
+	ts := time.Date(2021, 10, 1, 12, 30, 0, 0, time.UTC)
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, g.next(ts))
+	}
+	ids = append(ids, g.next(ts.Add(time.Millisecond)))
+	require.True(t, sort.StringsAreSorted(ids))
+	for _, id := range ids {
+		require.Len(t, id, 26)
+	}
+	it, err := KeyIDTime(ids[0])
+	require.NoError(t, err)
+	require.True(t, ts.Equal(it))
+
+	// carry into the high bits of the random part
+	g.lo = math.MaxUint64
+	before := g.next(ts)
+	after := g.next(ts)
+	require.Less(t, before, after)
+
+	require.Equal(t, "00000000000000000000000000", encodeKeyID(0, 0, 0))
+	require.Equal(t, "7ZZZZZZZZZ"+"ZZZZZZZZZZZZZZZZ", encodeKeyID(1<<48-1, math.MaxUint16, math.MaxUint64))
+
+	_, err = KeyIDTime("invalid")
+	require.Error(t, err)
+	require.NotEqual(t, NewKeyID(), NewKeyID())
+}
+
+func TestKVPutAuto(t *testing.T) {
+	kv, err := NewKV("AUTO")
+	require.NoError(t, err)
+	require.NoError(t, kv.DeleteAll())
+
+	first, err := kv.PutAuto(Task{ID: "1"})
+	require.NoError(t, err)
+	second, err := kv.PutAuto(Task{ID: "2"})
+	require.NoError(t, err)
+	require.Less(t, first, second)
+
+	var tasks []Task
+	_, err = kv.Find(&tasks, FindGreaterThan, first)
+	require.NoError(t, err)
+	require.Equal(t, []Task{{ID: "2"}}, tasks)
+}
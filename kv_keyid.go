@@ -0,0 +1,91 @@
+package mantil
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Crockford's base32 alphabet, without I, L, O and U; sorts same as the
+// encoded values.
+const keyIDAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// length of the key id: 10 characters of the timestamp, 16 of the random part
+const keyIDLength = 26
+
+// keyIDs generates monotonic key ids in the process.
+var keyIDs = &keyIDGenerator{}
+
+// NewKeyID generates unique, time ordered key in the ULID format.
+// Key is 26 characters long, first 10 encode milliseconds timestamp and
+// the rest are 80 random bits. Keys generated in the same millisecond in
+// the process are ordered by the generation order.
+// Example:
+//   id := mantil.NewKeyID() // 01FHZXHK8PTP9FVK99Z66GXQTX
+//
+func NewKeyID() string {
+	return keyIDs.next(time.Now())
+}
+
+// KeyIDTime returns time when the key id was generated, with milliseconds
+// precision.
+func KeyIDTime(id string) (time.Time, error) {
+	if len(id) != keyIDLength {
+		return time.Time{}, fmt.Errorf("invalid key id length %d", len(id))
+	}
+	var ms uint64
+	for _, c := range id[:10] {
+		i := strings.IndexRune(keyIDAlphabet, c)
+		if i < 0 {
+			return time.Time{}, fmt.Errorf("invalid key id character %c", c)
+		}
+		ms = ms<<5 | uint64(i)
+	}
+	return time.UnixMilli(int64(ms)), nil
+}
+
+type keyIDGenerator struct {
+	mu sync.Mutex
+	ms uint64
+	// 80 random bits
+	hi uint16
+	lo uint64
+}
+
+func (g *keyIDGenerator) next(t time.Time) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ms := uint64(t.UnixMilli())
+	if ms <= g.ms {
+		// same millisecond, or clock moved backwards, increment random part
+		// to keep the order
+		g.lo++
+		if g.lo == 0 {
+			g.hi++
+		}
+	} else {
+		var buf [10]byte
+		_, _ = rand.Read(buf[:])
+		g.ms = ms
+		g.hi = binary.BigEndian.Uint16(buf[:2])
+		g.lo = binary.BigEndian.Uint64(buf[2:])
+	}
+	return encodeKeyID(g.ms, g.hi, g.lo)
+}
+
+func encodeKeyID(ms uint64, hi uint16, lo uint64) string {
+	var id [keyIDLength]byte
+	for i := 9; i >= 0; i-- {
+		id[i] = keyIDAlphabet[ms&31]
+		ms >>= 5
+	}
+	for i := keyIDLength - 1; i >= 10; i-- {
+		id[i] = keyIDAlphabet[lo&31]
+		lo = lo>>5 | uint64(hi&31)<<59
+		hi >>= 5
+	}
+	return string(id[:])
+}
@@ -0,0 +1,202 @@
+package mantil
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	s3svc "github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// default name of the bucket for large KV values
+const kvBucketName = "kv"
+
+// WithLargeValues enables storing of values larger than DynamoDB item size
+// limit (400KB) into S3 bucket. DynamoDB item then holds only a pointer to
+// the S3 object. Offloaded values are transparently read in Get and Find and
+// removed on Delete.
+//
+// Bucket is a Mantil project resource name, see Resource. If empty default
+// "kv" bucket is used. Bucket is created on demand.
+func WithLargeValues(bucket string) KVOption {
+	return func(k *KV) error {
+		if bucket == "" {
+			bucket = kvBucketName
+		}
+		k.bucket = bucket
+		return nil
+	}
+}
+
+// WithCompression enables compression of the larger values before storing
+// them into DynamoDB. Compressed value attributes are stored packed so they
+// can't be used in Where conditions, except attributes of the declared
+// indexes which are stored in clear.
+func WithCompression() KVOption {
+	return func(k *KV) error {
+		k.compress = true
+		return nil
+	}
+}
+
+func (k *KV) initLargeValues() error {
+	s, err := newS3()
+	if err != nil {
+		return err
+	}
+	name := Resource(k.bucket).Name
+	if err := s.createBucket(name); err != nil {
+		return err
+	}
+	k.s3 = s
+	k.bucket = name
+	return nil
+}
+
+// objectKey creates unique S3 object key for the value of the key.
+// Each write gets new object so the failed write doesn't overwrite current
+// value.
+func (k *KV) objectKey(key string) string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return fmt.Sprintf("kv/%s/%s/%s", url.PathEscape(k.partition), url.PathEscape(key), hex.EncodeToString(buf))
+}
+
+func (k *KV) putObject(objectKey string, buf []byte) error {
+	_, err := k.s3.client.PutObject(context.TODO(), &s3svc.PutObjectInput{
+		Bucket: aws.String(k.bucket),
+		Key:    aws.String(objectKey),
+		Body:   bytes.NewReader(buf),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store value in S3 object %s, %w", objectKey, err)
+	}
+	return nil
+}
+
+func (k *KV) getObject(objectKey string) ([]byte, error) {
+	out, err := k.s3.client.GetObject(context.TODO(), &s3svc.GetObjectInput{
+		Bucket: aws.String(k.bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read value from S3 object %s, %w", objectKey, err)
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+// isObjectRemoved checks if the error is caused by reading of the S3 object
+// which doesn't exist anymore.
+func isObjectRemoved(err error) bool {
+	var nsk *s3types.NoSuchKey
+	return errors.As(err, &nsk)
+}
+
+// putObjects stores S3 objects of the large values. If any of them fails
+// already stored objects are removed.
+func (k *KV) putObjects(objects []*kvObject) error {
+	for i, o := range objects {
+		if err := k.putObject(o.key, o.payload); err != nil {
+			var stored []string
+			for _, s := range objects[:i] {
+				stored = append(stored, s.key)
+			}
+			_ = k.removeObjects(stored...)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeObjects deletes S3 objects.
+func (k *KV) removeObjects(objectKeys ...string) error {
+	if k.s3 == nil {
+		return nil
+	}
+	// max number of keys in a single DeleteObjects request
+	for _, chunk := range chunkKeys(objectKeys, 1000) {
+		var ids []s3types.ObjectIdentifier
+		for _, ok := range chunk {
+			ids = append(ids, s3types.ObjectIdentifier{Key: aws.String(ok)})
+		}
+		_, err := k.s3.client.DeleteObjects(context.TODO(), &s3svc.DeleteObjectsInput{
+			Bucket: aws.String(k.bucket),
+			Delete: &s3types.Delete{Objects: ids, Quiet: true},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete S3 objects, %w", err)
+		}
+	}
+	return nil
+}
+
+// storedObjects returns S3 object keys of the values currently stored for
+// keys. Used before batch operations which don't return previous values.
+func (k *KV) storedObjects(keys ...string) (map[string]string, error) {
+	objects := make(map[string]string)
+	if k.s3 == nil {
+		return objects, nil
+	}
+	for _, chunk := range chunkKeys(uniqueKeys(keys), batchGetSize) {
+		var avs []map[string]types.AttributeValue
+		for _, key := range chunk {
+			avs = append(avs, k.itemKey(key))
+		}
+		if err := k.batchGet(avs, func(item map[string]types.AttributeValue) {
+			sk, _ := item[SK].(*types.AttributeValueMemberS)
+			if sk == nil {
+				return
+			}
+			if o := objectKeyOf(item); o != "" {
+				objects[sk.Value] = o
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// replacedObjects returns objects from old which are not referenced by the
+// new items.
+func replacedObjects(old map[string]string, items map[string]map[string]types.AttributeValue) []string {
+	var replaced []string
+	for key, o := range old {
+		if item, ok := items[key]; ok && objectKeyOf(item) == o {
+			continue
+		}
+		replaced = append(replaced, o)
+	}
+	return replaced
+}
+
+// objectKeyOf returns S3 object key of the item value, empty string if the
+// value is not offloaded.
+func objectKeyOf(item map[string]types.AttributeValue) string {
+	if v, ok := item[attrObject].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]struct{})
+	var unique []string
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		unique = append(unique, key)
+	}
+	return unique
+}
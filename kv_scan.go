@@ -0,0 +1,245 @@
+package mantil
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// number of parallel scan segments used by KVPartitions
+const partitionsScanSegments = 4
+
+// KVPartitions returns sorted names of all partitions in the KV table.
+// Scans whole table so it is intended for admin tooling, not for the
+// regular request handling.
+func KVPartitions() ([]string, error) {
+	tn, err := config().kvTableName()
+	if err != nil {
+		return nil, err
+	}
+	d, err := newDynamo()
+	if err != nil {
+		return nil, err
+	}
+	k := &KV{tableName: tn, dynamo: d}
+	iter := k.scan(partitionsScanSegments, aws.String(PK))
+	defer iter.Close()
+	seen := make(map[string]struct{})
+	for iter.nextRaw() {
+		if pk, ok := iter.raw[PK].(*types.AttributeValueMemberS); ok {
+			seen[pk.Value] = struct{}{}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	partitions := make([]string, 0, len(seen))
+	for p := range seen {
+		partitions = append(partitions, p)
+	}
+	sort.Strings(partitions)
+	return partitions, nil
+}
+
+// DropPartition removes all items from the partition. Options are the same
+// as used for the partition in NewKV, WithLargeValues is required to remove
+// values offloaded to S3.
+func DropPartition(name string, opts ...KVOption) error {
+	k, err := NewKV(name, opts...)
+	if err != nil {
+		return err
+	}
+	return k.DeleteAll()
+}
+
+// KVItem is a single item returned by ScanAll.
+type KVItem struct {
+	Partition string
+	Key       string
+	value     map[string]types.AttributeValue
+}
+
+// Unmarshal converts item value to v.
+// Value provided must be a non-nil pointer type.
+func (i *KVItem) Unmarshal(v interface{}) error {
+	return attributevalue.UnmarshalMap(i.value, v)
+}
+
+// ScanAll returns iterator over items of all partitions in the KV table.
+// Table is scanned with the segments number of parallel scans, so items are
+// not returned in any particular order. Values are decoded with the options
+// of this KV.
+// Close must be called if iteration is stopped before Next returns false.
+// Example:
+//   iter := kv.ScanAll(4)
+//   defer iter.Close()
+//   for iter.Next() {
+//      item := iter.Item()
+//      ... use item.Partition, item.Key, item.Unmarshal(&v)
+//   }
+//   if err := iter.Err(); err != nil {
+//
+func (k *KV) ScanAll(segments int) *ScanIterator {
+	return k.scan(segments, nil)
+}
+
+// ScanIterator iterates over items returned by parallel scan of the KV table.
+type ScanIterator struct {
+	k     *KV
+	pages chan []map[string]types.AttributeValue
+	errc  chan error
+	done  chan struct{}
+	close sync.Once
+
+	page []map[string]types.AttributeValue
+	raw  map[string]types.AttributeValue
+	item *KVItem
+	err  error
+}
+
+func (k *KV) scan(segments int, projection *string) *ScanIterator {
+	if segments < 1 {
+		segments = 1
+	}
+	i := &ScanIterator{
+		k:     k,
+		pages: make(chan []map[string]types.AttributeValue, segments),
+		errc:  make(chan error, segments),
+		done:  make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	for s := 0; s < segments; s++ {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+			i.scanSegment(&dynamodb.ScanInput{
+				TableName:            aws.String(k.tableName),
+				Segment:              aws.Int32(int32(segment)),
+				TotalSegments:        aws.Int32(int32(segments)),
+				ProjectionExpression: projection,
+			})
+		}(s)
+	}
+	go func() {
+		wg.Wait()
+		close(i.pages)
+	}()
+	return i
+}
+
+func (i *ScanIterator) scanSegment(input *dynamodb.ScanInput) {
+	for {
+		out, err := i.k.dynamo.client.Scan(context.TODO(), input)
+		if err != nil {
+			i.errc <- err
+			return
+		}
+		select {
+		case i.pages <- out.Items:
+		case <-i.done:
+			return
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// Next advances iterator to the next item. Returns false when there are no
+// more items or on error.
+func (i *ScanIterator) Next() bool {
+	if !i.nextRaw() {
+		return false
+	}
+	item, err := i.k.scanItem(i.raw)
+	if err != nil {
+		i.fail(err)
+		return false
+	}
+	i.item = item
+	return true
+}
+
+func (i *ScanIterator) nextRaw() bool {
+	for len(i.page) == 0 {
+		if i.err != nil {
+			return false
+		}
+		select {
+		case err := <-i.errc:
+			i.fail(err)
+			return false
+		case page, ok := <-i.pages:
+			if !ok {
+				// segment error could be reported after the last page
+				select {
+				case err := <-i.errc:
+					i.fail(err)
+				default:
+				}
+				return false
+			}
+			i.page = page
+		}
+	}
+	i.raw = i.page[0]
+	i.page = i.page[1:]
+	return true
+}
+
+func (i *ScanIterator) fail(err error) {
+	i.err = err
+	i.Close()
+}
+
+// Item returns current item.
+func (i *ScanIterator) Item() *KVItem {
+	return i.item
+}
+
+// Err returns first error which stopped iteration.
+func (i *ScanIterator) Err() error {
+	return i.err
+}
+
+// Close stops parallel scans.
+func (i *ScanIterator) Close() {
+	i.close.Do(func() {
+		close(i.done)
+	})
+}
+
+// Each calls fn for each item. Iteration stops on the first fn error.
+func (i *ScanIterator) Each(fn func(*KVItem) error) error {
+	defer i.Close()
+	for i.Next() {
+		if err := fn(i.Item()); err != nil {
+			return err
+		}
+	}
+	return i.Err()
+}
+
+func (k *KV) scanItem(item map[string]types.AttributeValue) (*KVItem, error) {
+	pk, _ := item[PK].(*types.AttributeValueMemberS)
+	sk, _ := item[SK].(*types.AttributeValueMemberS)
+	if pk == nil || sk == nil {
+		return nil, fmt.Errorf("item without partition or key attribute")
+	}
+	av, err := k.onPartition(pk.Value).decode(item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s/%s, %w", pk.Value, sk.Value, err)
+	}
+	return &KVItem{
+		Partition: pk.Value,
+		Key:       sk.Value,
+		value:     av,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package mantil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+)
+
+func scanTestItem(partition, key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		PK:   &types.AttributeValueMemberS{Value: partition},
+		SK:   &types.AttributeValueMemberS{Value: key},
+		"ID": &types.AttributeValueMemberS{Value: key},
+	}
+}
+
+func TestScanIterator(t *testing.T) {
+	newIter := func() *ScanIterator {
+		return &ScanIterator{
+			k:     &KV{partition: "TODOS"},
+			pages: make(chan []map[string]types.AttributeValue, 2),
+			errc:  make(chan error, 1),
+			done:  make(chan struct{}),
+		}
+	}
+
+	i := newIter()
+	i.pages <- []map[string]types.AttributeValue{scanTestItem("TODOS", "1"), scanTestItem("USERS", "2")}
+	i.pages <- []map[string]types.AttributeValue{}
+	close(i.pages)
+	var keys []string
+	require.NoError(t, i.Each(func(item *KVItem) error {
+		var task Task
+		require.NoError(t, item.Unmarshal(&task))
+		keys = append(keys, item.Partition+"/"+task.ID)
+		return nil
+	}))
+	require.Equal(t, []string{"TODOS/1", "USERS/2"}, keys)
+
+	// segment error
+	i = newIter()
+	i.pages <- []map[string]types.AttributeValue{scanTestItem("TODOS", "1")}
+	close(i.pages)
+	i.errc <- fmt.Errorf("scan failed")
+	for i.Next() {
+	}
+	require.EqualError(t, i.Err(), "scan failed")
+	// done is closed
+	<-i.done
+
+	// invalid item
+	i = newIter()
+	i.pages <- []map[string]types.AttributeValue{{"ID": &types.AttributeValueMemberS{Value: "1"}}}
+	require.False(t, i.Next())
+	require.Error(t, i.Err())
+}
+
+func TestKVPartitions(t *testing.T) {
+	for _, p := range []string{"SCAN1", "SCAN2"} {
+		kv, err := NewKV(p)
+		require.NoError(t, err)
+		require.NoError(t, kv.Put("1", Task{ID: "1"}))
+		require.NoError(t, kv.Put("2", Task{ID: "2"}))
+	}
+	partitions, err := KVPartitions()
+	require.NoError(t, err)
+	require.Contains(t, partitions, "SCAN1")
+	require.Contains(t, partitions, "SCAN2")
+
+	kv, err := NewKV("SCAN1")
+	require.NoError(t, err)
+	found := 0
+	require.NoError(t, kv.ScanAll(3).Each(func(item *KVItem) error {
+		if item.Partition == "SCAN1" || item.Partition == "SCAN2" {
+			found++
+		}
+		return nil
+	}))
+	require.Equal(t, 4, found)
+
+	require.NoError(t, DropPartition("SCAN2"))
+	partitions, err = KVPartitions()
+	require.NoError(t, err)
+	require.NotContains(t, partitions, "SCAN2")
+	require.NoError(t, DropPartition("SCAN1"))
+}
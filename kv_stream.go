@@ -0,0 +1,248 @@
+package mantil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// WithStream enables DynamoDB Streams on the KV table. Stream records
+// contain both old and new item images, use KVChangeHandler to decode them.
+// Stream is enabled for the whole table, so it contains changes of all
+// partitions.
+func WithStream() KVOption {
+	return func(k *KV) error {
+		k.stream = true
+		return nil
+	}
+}
+
+// StreamARN returns ARN of the KV table stream, empty if the stream is not
+// enabled. Use it to connect Lambda function to the stream.
+func (k *KV) StreamARN() (string, error) {
+	table, err := k.dynamo.describeTable(k.tableName)
+	if err != nil {
+		return "", err
+	}
+	if table == nil {
+		return "", fmt.Errorf("table %s not found", k.tableName)
+	}
+	if !hasStream(table) {
+		return "", nil
+	}
+	return aws.ToString(table.LatestStreamArn), nil
+}
+
+// KV change types:
+const (
+	KVInsert = "insert"
+	KVModify = "modify"
+	KVRemove = "remove"
+)
+
+// KVChange is a single change of the KV item decoded from the stream record.
+// Old is empty for inserted and New for removed items.
+//
+// Large values, see WithLargeValues, are removed from S3 as soon as they are
+// replaced or deleted, which can be before the stream record is handled.
+// Such value is left empty and OldRemoved or NewRemoved is set.
+type KVChange struct {
+	Type       string                 `json:"type"`
+	Partition  string                 `json:"partition"`
+	Key        string                 `json:"key"`
+	Old        map[string]interface{} `json:"old,omitempty"`
+	New        map[string]interface{} `json:"new,omitempty"`
+	OldRemoved bool                   `json:"oldRemoved,omitempty"`
+	NewRemoved bool                   `json:"newRemoved,omitempty"`
+
+	oldItem map[string]types.AttributeValue
+	newItem map[string]types.AttributeValue
+}
+
+// OldValue unmarshals value before the change into v.
+// Returns ErrItemNotFound for inserted items and removed large values.
+func (c *KVChange) OldValue(v interface{}) error {
+	if c.oldItem == nil {
+		return &ErrItemNotFound{key: c.Key}
+	}
+	return attributevalue.UnmarshalMap(c.oldItem, v)
+}
+
+// NewValue unmarshals value after the change into v.
+// Returns ErrItemNotFound for removed items and removed large values.
+func (c *KVChange) NewValue(v interface{}) error {
+	if c.newItem == nil {
+		return &ErrItemNotFound{key: c.Key}
+	}
+	return attributevalue.UnmarshalMap(c.newItem, v)
+}
+
+// KVChangeSubject returns subject on which KVChangeHandler publishes changes
+// of the partition.
+func KVChangeSubject(partition string) string {
+	return "kv." + partition
+}
+
+// KVChangeHandler decodes DynamoDB stream events of the KV table into
+// changes. Lambda function connected to the stream receives events as the
+// payload of the default method.
+// Example:
+//   var changes = &mantil.KVChangeHandler{
+//   	Partitions: []string{"todos"},
+//   	Publish:    true,
+//   }
+//
+//   func (a *Api) Default(ctx context.Context, e events.DynamoDBEvent) error {
+//   	return changes.Handle(ctx, e)
+//   }
+//
+type KVChangeHandler struct {
+	// OnChange is called for each change, optional.
+	// Handling stops on the first error.
+	OnChange func(*KVChange) error
+	// Partitions to handle, changes of other partitions are skipped.
+	// All partitions are handled if empty.
+	Partitions []string
+	// Publish publishes each change to the KVChangeSubject of its
+	// partition, JS clients can subscribe to live updates.
+	Publish bool
+	// KV used to decode values. Required for the values stored with the
+	// WithEncryption or WithLargeValues options. Without KV index key
+	// attributes are recognized by the naming convention and removed.
+	KV *KV
+}
+
+// Handle decodes event records and calls OnChange and Publish for each
+// change.
+func (h *KVChangeHandler) Handle(ctx context.Context, event events.DynamoDBEvent) error {
+	for _, r := range event.Records {
+		c, err := h.change(r)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			continue
+		}
+		if h.OnChange != nil {
+			if err := h.OnChange(c); err != nil {
+				return err
+			}
+		}
+		if h.Publish {
+			if err := Publish(KVChangeSubject(c.Partition), c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// change decodes stream record, returns nil for skipped partitions.
+func (h *KVChangeHandler) change(r events.DynamoDBEventRecord) (*KVChange, error) {
+	keys, err := streamImage(r.Change.Keys)
+	if err != nil {
+		return nil, err
+	}
+	pk, _ := keys[PK].(*types.AttributeValueMemberS)
+	sk, _ := keys[SK].(*types.AttributeValueMemberS)
+	if pk == nil || sk == nil {
+		return nil, fmt.Errorf("stream record without partition or key attribute")
+	}
+	if !h.handles(pk.Value) {
+		return nil, nil
+	}
+	k := h.KV
+	if k == nil {
+		k = &KV{indexes: streamIndexes(pk.Value, r.Change.OldImage, r.Change.NewImage)}
+	}
+	k = k.onPartition(pk.Value)
+	c := &KVChange{
+		Type:      strings.ToLower(r.EventName),
+		Partition: pk.Value,
+		Key:       sk.Value,
+	}
+	if c.oldItem, c.Old, err = k.streamValue(r.Change.OldImage); err != nil {
+		if !isObjectRemoved(err) {
+			return nil, err
+		}
+		c.OldRemoved = true
+	}
+	if c.newItem, c.New, err = k.streamValue(r.Change.NewImage); err != nil {
+		if !isObjectRemoved(err) {
+			return nil, err
+		}
+		c.NewRemoved = true
+	}
+	return c, nil
+}
+
+func (h *KVChangeHandler) handles(partition string) bool {
+	if len(h.Partitions) == 0 {
+		return true
+	}
+	for _, p := range h.Partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// streamValue decodes stream item image into value attributes.
+func (k *KV) streamValue(image map[string]events.DynamoDBAttributeValue) (map[string]types.AttributeValue, map[string]interface{}, error) {
+	if len(image) == 0 {
+		return nil, nil, nil
+	}
+	item, err := streamImage(image)
+	if err != nil {
+		return nil, nil, err
+	}
+	av, err := k.decode(item)
+	if err != nil {
+		return nil, nil, err
+	}
+	av = k.valueAttributes(av)
+	var m map[string]interface{}
+	if err := attributevalue.UnmarshalMap(av, &m); err != nil {
+		return nil, nil, err
+	}
+	return av, m, nil
+}
+
+// streamIndexes finds index key attributes in the images, used when the
+// handler has no KV with declared indexes. Index is recognized by the
+// <index>_PK attribute with the value prefixed by the item partition.
+func streamIndexes(partition string, images ...map[string]events.DynamoDBAttributeValue) []kvIndex {
+	var indexes []kvIndex
+	found := make(map[string]bool)
+	for _, image := range images {
+		for name, v := range image {
+			if !strings.HasSuffix(name, "_PK") || v.DataType() != events.DataTypeString ||
+				!strings.HasPrefix(v.String(), partition+KeySeparator) {
+				continue
+			}
+			i := kvIndex{name: strings.TrimSuffix(name, "_PK")}
+			if !found[i.name] {
+				found[i.name] = true
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return indexes
+}
+
+// streamImage converts stream record image to the DynamoDB item.
+// Both use DynamoDB JSON format.
+func streamImage(image map[string]events.DynamoDBAttributeValue) (map[string]types.AttributeValue, error) {
+	buf, err := json.Marshal(image)
+	if err != nil {
+		return nil, err
+	}
+	return decodeItem(buf)
+}
@@ -0,0 +1,239 @@
+package mantil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	s3svc "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+// streamRecord creates stream record from the DynamoDB items.
+func streamRecord(t *testing.T, eventName string, oldItem, newItem map[string]types.AttributeValue) events.DynamoDBEventRecord {
+	image := func(item map[string]types.AttributeValue) json.RawMessage {
+		if item == nil {
+			return json.RawMessage("null")
+		}
+		buf, err := encodeItem(item)
+		require.NoError(t, err)
+		return buf
+	}
+	keys := oldItem
+	if keys == nil {
+		keys = newItem
+	}
+	raw, err := json.Marshal(map[string]interface{}{
+		"eventName": eventName,
+		"dynamodb": map[string]interface{}{
+			"Keys":     image(map[string]types.AttributeValue{PK: keys[PK], SK: keys[SK]}),
+			"OldImage": image(oldItem),
+			"NewImage": image(newItem),
+		},
+	})
+	require.NoError(t, err)
+	var r events.DynamoDBEventRecord
+	require.NoError(t, json.Unmarshal(raw, &r))
+	return r
+}
+
+func TestKVChangeHandler(t *testing.T) {
+	k := &KV{partition: "TODOS"}
+	require.NoError(t, WithIndex("byStatus", "Status", "")(k))
+	require.NoError(t, WithEncryption(testKeyProvider(t, "key1"))(k))
+
+	open, err := k.marshal("1", Task{ID: "1", Status: "open"})
+	require.NoError(t, err)
+	done, err := k.marshal("1", Task{ID: "1", Status: "done"})
+	require.NoError(t, err)
+	other, err := (&KV{partition: "OTHER"}).marshal("2", Task{ID: "2"})
+	require.NoError(t, err)
+
+	event := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{
+		streamRecord(t, "INSERT", nil, open),
+		streamRecord(t, "MODIFY", open, done),
+		streamRecord(t, "INSERT", nil, other),
+		streamRecord(t, "REMOVE", done, nil),
+	}}
+
+	var changes []*KVChange
+	h := &KVChangeHandler{
+		Partitions: []string{"TODOS"},
+		KV:         k,
+		OnChange: func(c *KVChange) error {
+			changes = append(changes, c)
+			return nil
+		},
+	}
+	require.NoError(t, h.Handle(context.Background(), event))
+	require.Len(t, changes, 3)
+
+	c := changes[0]
+	require.Equal(t, KVInsert, c.Type)
+	require.Equal(t, "TODOS", c.Partition)
+	require.Equal(t, "1", c.Key)
+	require.Nil(t, c.Old)
+	require.Equal(t, map[string]interface{}{"ID": "1", "Status": "open", "Due": ""}, c.New)
+	var task Task
+	require.Error(t, c.OldValue(&task))
+	require.NoError(t, c.NewValue(&task))
+	require.Equal(t, Task{ID: "1", Status: "open"}, task)
+
+	c = changes[1]
+	require.Equal(t, KVModify, c.Type)
+	require.NoError(t, c.OldValue(&task))
+	require.Equal(t, "open", task.Status)
+	require.NoError(t, c.NewValue(&task))
+	require.Equal(t, "done", task.Status)
+
+	c = changes[2]
+	require.Equal(t, KVRemove, c.Type)
+	require.Nil(t, c.New)
+	require.Equal(t, "done", c.Old["Status"])
+
+	// encrypted values can't be decoded without KV options
+	h.KV = nil
+	require.Error(t, h.Handle(context.Background(), event))
+}
+
+func TestKVChangeHandlerWithoutKV(t *testing.T) {
+	type owned struct {
+		Status  string
+		OwnerPK string `dynamodbav:"Owner_PK"`
+	}
+	k := &KV{partition: "TODOS"}
+	require.NoError(t, WithIndex("byStatus", "Status", "")(k))
+	item, err := k.marshal("1", owned{Status: "open", OwnerPK: "owner"})
+	require.NoError(t, err)
+	require.NotNil(t, item["byStatus_PK"])
+
+	var changes []*KVChange
+	h := &KVChangeHandler{
+		OnChange: func(c *KVChange) error {
+			changes = append(changes, c)
+			return nil
+		},
+	}
+	event := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{
+		streamRecord(t, "INSERT", nil, item),
+	}}
+	require.NoError(t, h.Handle(context.Background(), event))
+	require.Len(t, changes, 1)
+	require.Equal(t, map[string]interface{}{"Status": "open", "Owner_PK": "owner"}, changes[0].New)
+}
+
+// testObjectStore serves S3 GetObject requests for the stored objects.
+type testObjectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *testObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buf, ok := s.objects[strings.TrimPrefix(r.URL.Path, "/bucket/")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`))
+		return
+	}
+	_, _ = w.Write(buf)
+}
+
+func (s *testObjectStore) put(o *kvObject) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[o.key] = o.payload
+}
+
+func (s *testObjectStore) remove(o *kvObject) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, o.key)
+}
+
+func TestKVChangeHandlerRemovedObjects(t *testing.T) {
+	store := &testObjectStore{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+	k := &KV{
+		partition: "TODOS",
+		bucket:    "bucket",
+		s3: &s3{client: s3svc.New(s3svc.Options{
+			Region:           "us-east-1",
+			Credentials:      aws.AnonymousCredentials{},
+			EndpointResolver: s3svc.EndpointResolverFromURL(srv.URL),
+			UsePathStyle:     true,
+			Retryer:          aws.NopRetryer{},
+		})},
+	}
+
+	large := func(status string) (map[string]types.AttributeValue, *kvObject) {
+		av, err := attributevalue.MarshalMap(Task{ID: "1", Status: status, Due: randomString(offloadThreshold + 1)})
+		require.NoError(t, err)
+		item, obj, err := k.marshalItemDeferred("1", av)
+		require.NoError(t, err)
+		require.NotNil(t, obj)
+		return item, obj
+	}
+	// put, put again and delete, objects of the replaced and deleted values
+	// are removed
+	v1, o1 := large("open")
+	store.put(o1)
+	v2, o2 := large("done")
+	store.put(o2)
+	store.remove(o1)
+	store.remove(o2)
+	// put again, object exists
+	v3, o3 := large("new")
+	store.put(o3)
+
+	event := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{
+		streamRecord(t, "INSERT", nil, v1),
+		streamRecord(t, "MODIFY", v1, v2),
+		streamRecord(t, "REMOVE", v2, nil),
+		streamRecord(t, "INSERT", nil, v3),
+	}}
+	var changes []*KVChange
+	h := &KVChangeHandler{
+		KV: k,
+		OnChange: func(c *KVChange) error {
+			changes = append(changes, c)
+			return nil
+		},
+	}
+	require.NoError(t, h.Handle(context.Background(), event))
+	require.Len(t, changes, 4)
+
+	c := changes[0]
+	require.Equal(t, KVInsert, c.Type)
+	require.Equal(t, "1", c.Key)
+	require.True(t, c.NewRemoved)
+	require.False(t, c.OldRemoved)
+	require.Nil(t, c.New)
+	var task Task
+	require.Error(t, c.NewValue(&task))
+
+	c = changes[1]
+	require.Equal(t, KVModify, c.Type)
+	require.True(t, c.OldRemoved)
+	require.True(t, c.NewRemoved)
+
+	c = changes[2]
+	require.Equal(t, KVRemove, c.Type)
+	require.True(t, c.OldRemoved)
+	require.False(t, c.NewRemoved)
+
+	c = changes[3]
+	require.False(t, c.NewRemoved)
+	require.NoError(t, c.NewValue(&task))
+	require.Equal(t, "new", task.Status)
+}
@@ -2,9 +2,12 @@ package mantil
 
 import (
 	"fmt"
+	"math/rand"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -149,3 +152,236 @@ func TestKVPutGet(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, users, 0)
 }
+
+func TestKVBatch(t *testing.T) {
+	kv, err := NewKV(usersPartition)
+	require.NoError(t, err)
+
+	users := make(map[string]User)
+	var keys []string
+	for i := 0; i < 60; i++ {
+		key := fmt.Sprintf("user%02d", i)
+		users[key] = User{Key: key, Email: key + "@mantil.com"}
+		keys = append(keys, key)
+	}
+	err = kv.PutMany(users)
+	require.NoError(t, err)
+
+	var found []User
+	missing, err := kv.GetMany(append([]string{"user59", "nobody"}, keys...), &found)
+	require.NoError(t, err)
+	require.Equal(t, []string{"nobody"}, missing)
+	require.Len(t, found, 61)
+	require.Equal(t, "user59", found[0].Key)
+	require.Equal(t, "user00", found[1].Key)
+
+	// duplicate keys, last value is stored
+	err = kv.PutMany([]KeyValue{
+		{"user00", User{Key: "user00", Email: "first@mantil.com"}},
+		{"user00", User{Key: "user00", Email: "last@mantil.com"}},
+	})
+	require.NoError(t, err)
+	var u User
+	require.NoError(t, kv.Get("user00", &u))
+	require.Equal(t, "last@mantil.com", u.Email)
+
+	err = kv.Delete(keys...)
+	require.NoError(t, err)
+
+	found = nil
+	missing, err = kv.GetMany(keys, &found)
+	require.NoError(t, err)
+	require.Len(t, found, 0)
+	require.Equal(t, keys, missing)
+}
+
+func TestRetryBatch(t *testing.T) {
+	delay := batchRetryDelay
+	t.Cleanup(func() { batchRetryDelay = delay })
+	batchRetryDelay = time.Millisecond
+	calls := 0
+	err := retryBatch(func() (bool, error) {
+		calls++
+		return calls == 3, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	calls = 0
+	err = retryBatch(func() (bool, error) {
+		calls++
+		return false, nil
+	})
+	require.Error(t, err)
+	require.Equal(t, batchMaxRetries+1, calls)
+
+	kvs, err := keyValues(map[string]int{"b": 2, "a": 1})
+	require.NoError(t, err)
+	require.Equal(t, []KeyValue{{"a", 1}, {"b", 2}}, kvs)
+	_, err = keyValues([]int{1})
+	require.Error(t, err)
+}
+
+func TestPutManyDuplicatesAndObjects(t *testing.T) {
+	av := func(v string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{"V": &types.AttributeValueMemberS{Value: v}}
+	}
+	keys, avs := lastValues([]string{"a", "b", "a"}, []map[string]types.AttributeValue{av("1"), av("2"), av("3")})
+	require.Equal(t, []string{"a", "b"}, keys)
+	require.Equal(t, []map[string]types.AttributeValue{av("3"), av("2")}, avs)
+
+	wrs := []types.WriteRequest{
+		{PutRequest: &types.PutRequest{Item: map[string]types.AttributeValue{attrObject: &types.AttributeValueMemberS{Value: "o1"}}}},
+		{PutRequest: &types.PutRequest{Item: av("small")}},
+		{DeleteRequest: &types.DeleteRequest{Key: av("key")}},
+	}
+	require.Equal(t, []string{"o1"}, unwrittenObjects(wrs))
+}
+
+type Task struct {
+	ID     string
+	Status string
+	Due    string
+}
+
+func TestKVFindByIndex(t *testing.T) {
+	kv, err := NewKV("TASKS", WithIndex("byStatus", "Status", ""), WithIndex("byStatusDue", "Status", "Due"))
+	require.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		status := "open"
+		if i%2 == 0 {
+			status = "done"
+		}
+		task := Task{ID: fmt.Sprintf("%d", i), Status: status, Due: fmt.Sprintf("2021-10-0%d", 9-i)}
+		require.NoError(t, kv.Put(task.ID, task))
+	}
+
+	// index reads are eventually consistent, index may also still be created
+	var tasks []Task
+	require.Eventually(t, func() bool {
+		_, err = kv.FindByIndex("byStatus", &tasks, FindAll, "done")
+		return err == nil && len(tasks) == 3
+	}, 5*time.Minute, time.Second)
+	require.Eventually(t, func() bool {
+		_, err = kv.FindByIndex("byStatusDue", &tasks, FindAll, "done")
+		return err == nil && len(tasks) == 3
+	}, 5*time.Minute, time.Second)
+	_, err = kv.FindByIndex("byStatus", &tasks, FindAll, "done")
+	require.NoError(t, err)
+	require.Len(t, tasks, 3)
+	require.Equal(t, "0", tasks[0].ID)
+
+	_, err = kv.FindByIndex("byStatusDue", &tasks, FindLessThan, "done", "2021-10-08")
+	require.NoError(t, err)
+	require.Len(t, tasks, 2)
+	require.Equal(t, "4", tasks[0].ID)
+
+	_, err = kv.FindByIndex("unknown", &tasks, FindAll, "done")
+	require.Error(t, err)
+
+	require.NoError(t, kv.DeleteAll())
+}
+
+func TestKVIndexAttributes(t *testing.T) {
+	k := &KV{partition: "TASKS"}
+	require.NoError(t, WithIndex("byStatus", "Status", "")(k))
+	require.NoError(t, WithIndex("byDue", "Status", "Due")(k))
+	require.Error(t, WithIndex("byStatus", "Status", "")(k))
+	require.Error(t, WithIndex("by-status", "Status", "")(k))
+
+	av, err := k.marshal("1", Task{ID: "1", Status: "done"})
+	require.NoError(t, err)
+	require.Equal(t, &types.AttributeValueMemberS{Value: "TASKS#done"}, av["byStatus_PK"])
+	require.Equal(t, &types.AttributeValueMemberS{Value: "1"}, av["byStatus_SK"])
+	// empty Due is not indexed
+	require.Nil(t, av["byDue_PK"])
+	require.Nil(t, av["byDue_SK"])
+
+	av, err = k.marshal("2", map[string]interface{}{"ID": "2"})
+	require.NoError(t, err)
+	require.Nil(t, av["byStatus_PK"])
+	require.Nil(t, av["byDue_PK"])
+}
+
+func TestKVFindOptions(t *testing.T) {
+	kv, err := NewKV("TASKS")
+	require.NoError(t, err)
+	for i := 0; i < 6; i++ {
+		status := "open"
+		if i%2 == 0 {
+			status = "done"
+		}
+		task := Task{ID: fmt.Sprintf("%d", i), Status: status, Due: "2021-10-01"}
+		require.NoError(t, kv.Put(task.ID, task))
+	}
+
+	var tasks []Task
+	iter, err := kv.FindWith(&tasks, FindGreaterThan, []string{"0"}, Desc(), Limit(2))
+	require.NoError(t, err)
+	require.True(t, iter.HasMore())
+	require.Len(t, tasks, 2)
+	require.Equal(t, "5", tasks[0].ID)
+	require.Equal(t, "4", tasks[1].ID)
+
+	_, err = kv.FindAll(&tasks, Where("Status", "=", "done"), Project("ID", "Status"))
+	require.NoError(t, err)
+	require.Len(t, tasks, 3)
+	for _, task := range tasks {
+		require.Equal(t, "done", task.Status)
+		require.Empty(t, task.Due)
+	}
+
+	require.NoError(t, kv.DeleteAll())
+}
+
+func TestFindOptions(t *testing.T) {
+	opts := newFindOptions([]FindOption{Desc(), Limit(3), Project("Status"), Where("Status", "=", "done")})
+
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":PK": &types.AttributeValueMemberS{Value: "TASKS"},
+		},
+	}
+	require.NoError(t, opts.apply(&KV{partition: "TASKS"}, input))
+	require.False(t, *input.ScanIndexForward)
+	require.Equal(t, int32(3), *input.Limit)
+	require.Equal(t, "#n0", *input.ProjectionExpression)
+	require.Equal(t, "#n0 = :v0", *input.FilterExpression)
+	require.Equal(t, map[string]string{"#n0": "Status"}, input.ExpressionAttributeNames)
+	require.Len(t, input.ExpressionAttributeValues, 2)
+}
+
+func TestKVLargeValues(t *testing.T) {
+	kv, err := NewKV(todosPartition, WithLargeValues(""), WithCompression())
+	require.NoError(t, err)
+
+	large := Todo{ID: "large", Description: randomString(1024 * 1024)}
+	require.NoError(t, kv.Put(large.ID, large))
+
+	var todo Todo
+	require.NoError(t, kv.Get(large.ID, &todo))
+	require.Equal(t, large.Description, todo.Description)
+
+	var todos []Todo
+	_, err = kv.FindAll(&todos)
+	require.NoError(t, err)
+	require.Len(t, todos, 1)
+	require.Equal(t, large.Description, todos[0].Description)
+
+	// replace with small value
+	require.NoError(t, kv.Put(large.ID, Todo{ID: "large"}))
+	require.NoError(t, kv.Get(large.ID, &todo))
+	require.Empty(t, todo.Description)
+
+	require.NoError(t, kv.DeleteAll())
+}
+
+func randomString(n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(b)
+}
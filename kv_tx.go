@@ -0,0 +1,422 @@
+package mantil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maximum number of items in DynamoDB transaction
+const txMaxItems = 100
+
+// Tx is a builder of the write transaction. All operations are executed
+// atomically on Commit. Either all of them succeed or none.
+//
+// Operations are applied to the KV partition on which the transaction is
+// created. Use On to switch to another partition.
+// Example:
+//   err := orders.Tx().
+//   	Put(orderID, order, mantil.AttributeNotExists(mantil.SK)).
+//   	On(stock).
+//   	Add(productID, "Stock", -1, mantil.Where("Stock", ">", 0)).
+//   	Commit()
+//
+type Tx struct {
+	k     *KV
+	items []types.TransactWriteItem
+	ops   []txOp
+	err   error
+}
+
+// txOp describes transaction item, used for error reporting.
+type txOp struct {
+	partition string
+	key       string
+	op        string
+	k         *KV
+	// item written by put operation
+	item map[string]types.AttributeValue
+	// S3 object of the large value, stored on commit
+	object *kvObject
+}
+
+// Tx starts new write transaction.
+func (k *KV) Tx() *Tx {
+	return &Tx{k: k}
+}
+
+// On switches transaction to the partition of another KV. Following
+// operations are applied to that partition.
+func (t *Tx) On(k *KV) *Tx {
+	t.k = k
+	return t
+}
+
+// Put adds put operation to the transaction.
+// Put will be executed only if all conditions are satisfied.
+// Large values are stored in S3 on Commit.
+func (t *Tx) Put(key string, value interface{}, conds ...Condition) *Tx {
+	values, err := attributevalue.MarshalMap(value)
+	if err != nil {
+		return t.fail(fmt.Errorf("failed to marshal record, %w", err))
+	}
+	av, obj, err := t.k.marshalItemDeferred(key, values)
+	if err != nil {
+		return t.fail(err)
+	}
+	condition, e, err := t.conditions(conds)
+	if err != nil {
+		return t.fail(err)
+	}
+	t.add(key, "put", types.TransactWriteItem{
+		Put: &types.Put{
+			TableName:                 aws.String(t.k.tableName),
+			Item:                      av,
+			ConditionExpression:       nilIfEmpty(condition),
+			ExpressionAttributeNames:  e.attributeNames(),
+			ExpressionAttributeValues: e.attributeValues(),
+		},
+	})
+	t.ops[len(t.ops)-1].item = av
+	t.ops[len(t.ops)-1].object = obj
+	return t
+}
+
+// Delete adds delete operation to the transaction.
+// Delete will be executed only if all conditions are satisfied.
+func (t *Tx) Delete(key string, conds ...Condition) *Tx {
+	condition, e, err := t.conditions(conds)
+	if err != nil {
+		return t.fail(err)
+	}
+	return t.add(key, "delete", types.TransactWriteItem{
+		Delete: &types.Delete{
+			TableName:                 aws.String(t.k.tableName),
+			Key:                       t.k.itemKey(key),
+			ConditionExpression:       nilIfEmpty(condition),
+			ExpressionAttributeNames:  e.attributeNames(),
+			ExpressionAttributeValues: e.attributeValues(),
+		},
+	})
+}
+
+// Add adds delta to the numeric attribute of the item. Use negative delta to
+// decrement. Attribute is created if it doesn't exists.
+// Update will be executed only if all conditions are satisfied.
+//
+// When KV uses compression, encryption or offload to S3 value attributes
+// are packed, and only indexed attributes can be used in Add and conditions
+// of the transaction operations. Otherwise Commit returns error.
+func (t *Tx) Add(key, attribute string, delta int64, conds ...Condition) *Tx {
+	if err := t.k.checkClearAttribute(attribute); err != nil {
+		return t.fail(err)
+	}
+	condition, e, err := t.conditions(conds)
+	if err != nil {
+		return t.fail(err)
+	}
+	value, err := e.value(delta)
+	if err != nil {
+		return t.fail(err)
+	}
+	return t.add(key, "add", types.TransactWriteItem{
+		Update: &types.Update{
+			TableName:                 aws.String(t.k.tableName),
+			Key:                       t.k.itemKey(key),
+			UpdateExpression:          aws.String(fmt.Sprintf("ADD %s %s", e.name(attribute), value)),
+			ConditionExpression:       nilIfEmpty(condition),
+			ExpressionAttributeNames:  e.attributeNames(),
+			ExpressionAttributeValues: e.attributeValues(),
+		},
+	})
+}
+
+// ConditionCheck adds check of the item which is not modified by the
+// transaction. Transaction fails if any of the conditions is not satisfied.
+func (t *Tx) ConditionCheck(key string, conds ...Condition) *Tx {
+	if len(conds) == 0 {
+		return t.fail(fmt.Errorf("condition check for key %s without conditions", key))
+	}
+	condition, e, err := t.conditions(conds)
+	if err != nil {
+		return t.fail(err)
+	}
+	return t.add(key, "condition check", types.TransactWriteItem{
+		ConditionCheck: &types.ConditionCheck{
+			TableName:                 aws.String(t.k.tableName),
+			Key:                       t.k.itemKey(key),
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  e.attributeNames(),
+			ExpressionAttributeValues: e.attributeValues(),
+		},
+	})
+}
+
+// conditions builds condition expression, attributes of the conditions must
+// not be packed.
+func (t *Tx) conditions(conds []Condition) (string, *expression, error) {
+	if err := t.k.checkConditions(conds); err != nil {
+		return "", nil, err
+	}
+	e := newExpression()
+	condition, err := e.conditions(conds)
+	return condition, e, err
+}
+
+func (t *Tx) add(key, op string, item types.TransactWriteItem) *Tx {
+	t.items = append(t.items, item)
+	t.ops = append(t.ops, txOp{partition: t.k.partition, key: key, op: op, k: t.k})
+	return t
+}
+
+func (t *Tx) fail(err error) *Tx {
+	if t.err == nil {
+		t.err = err
+	}
+	return t
+}
+
+// Commit executes transaction.
+// If the transaction is canceled returns ErrTxCanceled with the reasons for
+// each failed operation.
+func (t *Tx) Commit() error {
+	if t.err != nil {
+		return t.err
+	}
+	if len(t.items) == 0 {
+		return nil
+	}
+	if len(t.items) > txMaxItems {
+		return fmt.Errorf("transaction has %d items, max is %d", len(t.items), txMaxItems)
+	}
+	objects, err := t.storedObjects()
+	if err != nil {
+		return err
+	}
+	if err := t.putObjects(); err != nil {
+		return err
+	}
+	_, err = t.k.dynamo.client.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+		TransactItems: t.items,
+	})
+	for _, op := range t.ops {
+		if op.op != "condition check" {
+			kvCache.invalidate(op.k, op.key)
+		}
+	}
+	if err != nil {
+		t.removeObjects(len(t.ops))
+		return txError(err, t.ops)
+	}
+	// remove S3 objects of the replaced or deleted values
+	for k, old := range objects {
+		items := make(map[string]map[string]types.AttributeValue)
+		for _, op := range t.ops {
+			if op.k == k && op.op != "delete" {
+				items[op.key] = op.item
+			}
+		}
+		if err := k.removeObjects(replacedObjects(old, items)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putObjects stores S3 objects of the large values of put operations.
+// On failure already stored objects are removed.
+func (t *Tx) putObjects() error {
+	for i, op := range t.ops {
+		if op.object == nil {
+			continue
+		}
+		if err := op.k.putObject(op.object.key, op.object.payload); err != nil {
+			t.removeObjects(i)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeObjects removes S3 objects stored by the first n operations.
+func (t *Tx) removeObjects(n int) {
+	for _, op := range t.ops[:n] {
+		if op.object != nil {
+			_ = op.k.removeObjects(op.object.key)
+		}
+	}
+}
+
+// storedObjects returns S3 objects of the values currently stored for keys
+// changed by put or delete operations, grouped by KV.
+func (t *Tx) storedObjects() (map[*KV]map[string]string, error) {
+	keys := make(map[*KV][]string)
+	for _, op := range t.ops {
+		if op.k.s3 != nil && (op.op == "put" || op.op == "delete") {
+			keys[op.k] = append(keys[op.k], op.key)
+		}
+	}
+	objects := make(map[*KV]map[string]string)
+	for k, ks := range keys {
+		o, err := k.storedObjects(ks...)
+		if err != nil {
+			return nil, err
+		}
+		objects[k] = o
+	}
+	return objects, nil
+}
+
+// TxGet is a builder of the read transaction. All items are read atomically
+// on Commit.
+// Example:
+//   var order Order
+//   var product Product
+//   err := orders.TransactGet().
+//   	Get(orderID, &order).
+//   	On(stock).
+//   	Get(productID, &product).
+//   	Commit()
+//
+type TxGet struct {
+	k      *KV
+	items  []types.TransactGetItem
+	ops    []txOp
+	values []interface{}
+}
+
+// TransactGet starts new read transaction.
+func (k *KV) TransactGet() *TxGet {
+	return &TxGet{k: k}
+}
+
+// On switches transaction to the partition of another KV. Following
+// reads are from that partition.
+func (t *TxGet) On(k *KV) *TxGet {
+	t.k = k
+	return t
+}
+
+// Get adds read of the key to the transaction.
+// Value provided must be a non-nil pointer type.
+func (t *TxGet) Get(key string, value interface{}) *TxGet {
+	t.items = append(t.items, types.TransactGetItem{
+		Get: &types.Get{
+			TableName: aws.String(t.k.tableName),
+			Key:       t.k.itemKey(key),
+		},
+	})
+	t.ops = append(t.ops, txOp{partition: t.k.partition, key: key, op: "get", k: t.k})
+	t.values = append(t.values, value)
+	return t
+}
+
+// Commit executes read transaction and fills values.
+// If some of the items are not found returns ErrItemNotFound for the first
+// missing key, all found values are filled.
+func (t *TxGet) Commit() error {
+	if len(t.items) == 0 {
+		return nil
+	}
+	if len(t.items) > txMaxItems {
+		return fmt.Errorf("transaction has %d items, max is %d", len(t.items), txMaxItems)
+	}
+	out, err := t.k.dynamo.client.TransactGetItems(context.TODO(), &dynamodb.TransactGetItemsInput{
+		TransactItems: t.items,
+	})
+	if err != nil {
+		return txError(err, t.ops)
+	}
+	var notFound error
+	for i, r := range out.Responses {
+		if r.Item == nil {
+			if notFound == nil {
+				notFound = &ErrItemNotFound{key: t.ops[i].key}
+			}
+			continue
+		}
+		if err := t.ops[i].k.unmarshalItem(r.Item, t.values[i]); err != nil {
+			return err
+		}
+	}
+	return notFound
+}
+
+// ErrTxCanceled is returned when DynamoDB cancels transaction.
+// Reasons contains failed operations.
+type ErrTxCanceled struct {
+	Reasons []TxFailure
+	msg     string
+}
+
+// TxFailure describes transaction operation which caused transaction
+// cancellation.
+type TxFailure struct {
+	Partition string
+	Key       string
+	// Operation name: put, delete, add, condition check or get
+	Op string
+	// DynamoDB cancellation reason code, for example ConditionalCheckFailed
+	Code    string
+	Message string
+}
+
+func (e ErrTxCanceled) Error() string {
+	if len(e.Reasons) == 0 {
+		return fmt.Sprintf("transaction canceled: %s", e.msg)
+	}
+	var reasons []string
+	for _, r := range e.Reasons {
+		reasons = append(reasons, fmt.Sprintf("%s %s/%s: %s", r.Op, r.Partition, r.Key, r.Code))
+	}
+	return fmt.Sprintf("transaction canceled: %s", strings.Join(reasons, ", "))
+}
+
+// ConditionFailed returns operations whose conditions were not satisfied.
+func (e ErrTxCanceled) ConditionFailed() []TxFailure {
+	var fs []TxFailure
+	for _, r := range e.Reasons {
+		if r.Code == "ConditionalCheckFailed" {
+			fs = append(fs, r)
+		}
+	}
+	return fs
+}
+
+// txError converts DynamoDB transaction canceled exception into
+// ErrTxCanceled. Cancellation reasons are in the same order as transaction
+// items.
+func txError(err error, ops []txOp) error {
+	var tce *types.TransactionCanceledException
+	if !errors.As(err, &tce) {
+		return err
+	}
+	e := &ErrTxCanceled{msg: tce.ErrorMessage()}
+	for i, r := range tce.CancellationReasons {
+		code := aws.ToString(r.Code)
+		if code == "" || code == "None" || i >= len(ops) {
+			continue
+		}
+		e.Reasons = append(e.Reasons, TxFailure{
+			Partition: ops[i].partition,
+			Key:       ops[i].key,
+			Op:        ops[i].op,
+			Code:      code,
+			Message:   aws.ToString(r.Message),
+		})
+	}
+	return e
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
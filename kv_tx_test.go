@@ -0,0 +1,142 @@
+package mantil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+)
+
+type Product struct {
+	Name  string
+	Stock int
+}
+
+type Order struct {
+	ID      string
+	Product string
+}
+
+func TestKVTx(t *testing.T) {
+	orders, err := NewKV("ORDERS")
+	require.NoError(t, err)
+	stock, err := NewKV("STOCK")
+	require.NoError(t, err)
+
+	err = stock.Put("p1", Product{Name: "p1", Stock: 1})
+	require.NoError(t, err)
+
+	order := func(id string) error {
+		return orders.Tx().
+			Put(id, Order{ID: id, Product: "p1"}, AttributeNotExists(SK)).
+			On(stock).
+			Add("p1", "Stock", -1, Where("Stock", ">", 0)).
+			Commit()
+	}
+	require.NoError(t, order("o1"))
+
+	var o Order
+	var p Product
+	err = orders.TransactGet().Get("o1", &o).On(stock).Get("p1", &p).Commit()
+	require.NoError(t, err)
+	require.Equal(t, "p1", o.Product)
+	require.Equal(t, 0, p.Stock)
+
+	// out of stock
+	err = order("o2")
+	var txErr *ErrTxCanceled
+	require.True(t, errors.As(err, &txErr))
+	failed := txErr.ConditionFailed()
+	require.Len(t, failed, 1)
+	require.Equal(t, "STOCK", failed[0].Partition)
+	require.Equal(t, "p1", failed[0].Key)
+
+	err = orders.Get("o2", &o)
+	require.Error(t, err)
+
+	err = orders.TransactGet().Get("o2", &o).Commit()
+	var nf *ErrItemNotFound
+	require.True(t, errors.As(err, &nf))
+
+	require.NoError(t, orders.DeleteAll())
+	require.NoError(t, stock.DeleteAll())
+}
+
+func TestTxError(t *testing.T) {
+	ops := []txOp{
+		{partition: "ORDERS", key: "o1", op: "put"},
+		{partition: "STOCK", key: "p1", op: "add"},
+	}
+	err := txError(&types.TransactionCanceledException{
+		Message: aws.String("canceled"),
+		CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("None")},
+			{Code: aws.String("ConditionalCheckFailed"), Message: aws.String("failed")},
+		},
+	}, ops)
+	var txErr *ErrTxCanceled
+	require.True(t, errors.As(err, &txErr))
+	require.Len(t, txErr.Reasons, 1)
+	require.Equal(t, TxFailure{Partition: "STOCK", Key: "p1", Op: "add", Code: "ConditionalCheckFailed", Message: "failed"}, txErr.Reasons[0])
+	require.Equal(t, "transaction canceled: add STOCK/p1: ConditionalCheckFailed", err.Error())
+
+	other := errors.New("other")
+	require.Equal(t, other, txError(other, ops))
+}
+
+func TestTxLargeValueStoredOnCommit(t *testing.T) {
+	// S3 client is not set, any call to S3 would panic
+	k := &KV{partition: "TODOS", tableName: "table", s3: &s3{}}
+	tx := k.Tx().
+		Put("large", Todo{ID: "large", Description: randomString(offloadThreshold + 1)}).
+		ConditionCheck("other")
+	require.Len(t, tx.ops, 1)
+	obj := tx.ops[0].object
+	require.NotNil(t, obj)
+	require.Equal(t, obj.key, objectKeyOf(tx.ops[0].item))
+	require.Nil(t, tx.ops[0].item[attrValue])
+
+	// failed builder step, nothing is stored
+	require.Error(t, tx.Commit())
+}
+
+func TestTxPackedAttributes(t *testing.T) {
+	k := &KV{partition: "STOCK", tableName: "table"}
+	require.NoError(t, WithIndex("byName", "Name", "")(k))
+	// without packing any attribute can be used
+	require.NoError(t, k.Tx().Add("p1", "Stock", -1, Where("Stock", ">", 0)).err)
+
+	require.NoError(t, WithCompression()(k))
+	require.Error(t, k.Tx().Add("p1", "Stock", -1).err)
+	require.Error(t, k.Tx().Delete("p1", Where("Stock", ">", 0)).err)
+	require.Error(t, k.Tx().ConditionCheck("p1", AttributeExists("Stock")).err)
+	require.Error(t, k.Tx().Put("p1", Product{Name: "p1"}, Where("Stock", "=", 0)).err)
+	// keys and indexed attributes are kept in clear
+	tx := k.Tx().
+		Put("p1", Product{Name: "p1"}, AttributeNotExists(SK)).
+		ConditionCheck("p2", Where("Name", "=", "p2"))
+	require.NoError(t, tx.err)
+	require.Len(t, tx.ops, 2)
+
+	// find filters
+	_, err := k.FindWith(nil, FindAll, nil, Where("Stock", ">", 0))
+	require.Error(t, err)
+}
+
+func TestExpressionConditions(t *testing.T) {
+	e := newExpression()
+	s, err := e.conditions([]Condition{
+		Where("Stock", ">", 0),
+		Where("Name", "begins_with", "p"),
+		AttributeNotExists("Stock"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "#n0 > :v0 AND begins_with(#n1, :v1) AND attribute_not_exists(#n0)", s)
+	require.Equal(t, map[string]string{"#n0": "Stock", "#n1": "Name"}, e.attributeNames())
+	require.Len(t, e.attributeValues(), 2)
+
+	_, err = e.condition(Where("Stock", "!", 0))
+	require.Error(t, err)
+}
@@ -0,0 +1,183 @@
+package mantil
+
+import "fmt"
+
+// KeyFunc derives KV key from the value.
+type KeyFunc[T any] func(T) string
+
+// TypedKV is KV store of the values of type T.
+// Type checks are done by the compiler instead of the runtime reflection
+// on the interface{} arguments.
+// Example:
+//   todos, err := mantil.NewTypedKV[Todo]("todos")
+//   err = todos.Put("1", Todo{ID: "1", Title: "first"})
+//   todo, err := todos.Get("1")
+//   items, iter, err := todos.Find(mantil.FindBeginsWith, "2021-")
+//
+type TypedKV[T any] struct {
+	kv      *KV
+	keyFunc KeyFunc[T]
+}
+
+// NewTypedKV creates new typed KV store for the partition.
+// Options are the same as for NewKV.
+func NewTypedKV[T any](partition string, opts ...KVOption) (*TypedKV[T], error) {
+	kv, err := NewKV(partition, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return Typed[T](kv), nil
+}
+
+// Typed wraps existing KV store into typed KV.
+func Typed[T any](kv *KV) *TypedKV[T] {
+	return &TypedKV[T]{kv: kv}
+}
+
+// WithKeyFunc sets function used by Save to derive key from the value.
+// Example:
+//   todos = todos.WithKeyFunc(func(t Todo) string { return t.ID })
+//   key, err := todos.Save(todo)
+//
+func (t *TypedKV[T]) WithKeyFunc(fn KeyFunc[T]) *TypedKV[T] {
+	t.keyFunc = fn
+	return t
+}
+
+// KV returns underlying untyped KV store.
+func (t *TypedKV[T]) KV() *KV {
+	return t.kv
+}
+
+// Get value for the key.
+func (t *TypedKV[T]) Get(key string, opts ...GetOption) (T, error) {
+	var v T
+	err := t.kv.Get(key, &v, opts...)
+	return v, err
+}
+
+// Put value into store by key.
+func (t *TypedKV[T]) Put(key string, v T) error {
+	return t.kv.Put(key, v)
+}
+
+// Save puts value into store by key derived with the key function.
+// Returns used key.
+func (t *TypedKV[T]) Save(v T) (string, error) {
+	key, err := t.key(v)
+	if err != nil {
+		return "", err
+	}
+	return key, t.kv.Put(key, v)
+}
+
+// SaveMany puts values into store in batches, keys are derived with the
+// key function.
+func (t *TypedKV[T]) SaveMany(vs ...T) error {
+	kvs := make([]KeyValue, 0, len(vs))
+	for _, v := range vs {
+		key, err := t.key(v)
+		if err != nil {
+			return err
+		}
+		kvs = append(kvs, KeyValue{Key: key, Value: v})
+	}
+	return t.kv.PutMany(kvs)
+}
+
+func (t *TypedKV[T]) key(v T) (string, error) {
+	if t.keyFunc == nil {
+		return "", fmt.Errorf("key function is not set, use WithKeyFunc")
+	}
+	key := t.keyFunc(v)
+	if key == "" {
+		return "", fmt.Errorf("key function returned empty key")
+	}
+	return key, nil
+}
+
+// Delete keys from store.
+func (t *TypedKV[T]) Delete(keys ...string) error {
+	return t.kv.Delete(keys...)
+}
+
+// Find searches store and returns first page of items and iterator for
+// reading following pages. Arguments are the same as in KV.Find.
+func (t *TypedKV[T]) Find(op FindOperator, args ...string) ([]T, *Iterator[T], error) {
+	return t.FindWith(op, args)
+}
+
+// FindWith is Find with find options, see KV.FindWith.
+func (t *TypedKV[T]) FindWith(op FindOperator, keys []string, opts ...FindOption) ([]T, *Iterator[T], error) {
+	var items []T
+	iter, err := t.kv.FindWith(&items, op, keys, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, &Iterator[T]{iter: iter}, nil
+}
+
+// FindAll returns first page of all items in store and iterator for
+// reading following pages.
+func (t *TypedKV[T]) FindAll(opts ...FindOption) ([]T, *Iterator[T], error) {
+	var items []T
+	iter, err := t.kv.FindAll(&items, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, &Iterator[T]{iter: iter}, nil
+}
+
+// FindByIndex searches index, arguments are the same as in KV.FindByIndex.
+func (t *TypedKV[T]) FindByIndex(index string, op FindOperator, args ...string) ([]T, *Iterator[T], error) {
+	return t.FindByIndexWith(index, op, args)
+}
+
+// FindByIndexWith is FindByIndex with find options, see KV.FindWith.
+func (t *TypedKV[T]) FindByIndexWith(index string, op FindOperator, keys []string, opts ...FindOption) ([]T, *Iterator[T], error) {
+	var items []T
+	iter, err := t.kv.FindByIndexWith(index, &items, op, keys, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, &Iterator[T]{iter: iter}, nil
+}
+
+// Iterator is typed FindIterator.
+type Iterator[T any] struct {
+	iter *FindIterator
+}
+
+// HasMore returns true if there are more items after the last read page.
+func (i *Iterator[T]) HasMore() bool {
+	return i.iter.HasMore()
+}
+
+// Count returns number of items in the last read page.
+func (i *Iterator[T]) Count() int {
+	return i.iter.Count()
+}
+
+// Next reads next page of items.
+// Returns empty slice if there are no more items.
+func (i *Iterator[T]) Next() ([]T, error) {
+	items := make([]T, 0)
+	if !i.HasMore() {
+		return items, nil
+	}
+	if err := i.iter.Next(&items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Cursor returns token of the iterator position, see FindIterator.Cursor.
+func (i *Iterator[T]) Cursor() (string, error) {
+	return i.iter.Cursor()
+}
+
+// Each calls fn for each item starting from the last read page, see
+// FindIterator.Each.
+func (i *Iterator[T]) Each(fn func(T) error) error {
+	return i.iter.Each(fn)
+}
@@ -0,0 +1,57 @@
+package mantil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedKVKey(t *testing.T) {
+	tasks := Typed[Task](&KV{partition: "TASKS"})
+	_, err := tasks.key(Task{ID: "1"})
+	require.Error(t, err)
+
+	tasks.WithKeyFunc(func(t Task) string { return t.ID })
+	key, err := tasks.key(Task{ID: "1"})
+	require.NoError(t, err)
+	require.Equal(t, "1", key)
+	_, err = tasks.key(Task{})
+	require.Error(t, err)
+}
+
+func TestTypedKV(t *testing.T) {
+	tasks, err := NewTypedKV[Task]("TYPED")
+	require.NoError(t, err)
+	require.NoError(t, tasks.KV().DeleteAll())
+	tasks.WithKeyFunc(func(t Task) string { return t.ID })
+
+	key, err := tasks.Save(Task{ID: "1", Status: "open"})
+	require.NoError(t, err)
+	require.Equal(t, "1", key)
+	require.NoError(t, tasks.SaveMany(Task{ID: "2", Status: "done"}, Task{ID: "3", Status: "open"}))
+
+	task, err := tasks.Get("1")
+	require.NoError(t, err)
+	require.Equal(t, Task{ID: "1", Status: "open"}, task)
+
+	items, iter, err := tasks.FindWith(FindGreaterThan, []string{"1"}, Limit(1))
+	require.NoError(t, err)
+	require.Equal(t, []Task{{ID: "2", Status: "done"}}, items)
+	require.True(t, iter.HasMore())
+	items, err = iter.Next()
+	require.NoError(t, err)
+	require.Equal(t, []Task{{ID: "3", Status: "open"}}, items)
+
+	var ids []string
+	_, iter, err = tasks.FindAll()
+	require.NoError(t, err)
+	require.NoError(t, iter.Each(func(t Task) error {
+		ids = append(ids, t.ID)
+		return nil
+	}))
+	require.Equal(t, []string{"1", "2", "3"}, ids)
+
+	require.NoError(t, tasks.Delete("1"))
+	_, err = tasks.Get("1")
+	require.Error(t, err)
+}
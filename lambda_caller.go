@@ -54,19 +54,29 @@ func NewLambdaInvoker(function, role string) (*LambdaInvoker, error) {
 }
 
 func (l *LambdaInvoker) setup() error {
-	cfg, err := awsConfig.LoadDefaultConfig(context.Background())
+	cfg, err := loadAWSConfig(context.Background())
 	if err != nil {
 		return err
 	}
-	cred := cfg.Credentials
-
-	if l.role != "" {
-		cred = stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), l.role)
-	}
-
-	l.client = lambda.New(lambda.Options{
-		Region:      l.region(cfg),
-		Credentials: cred,
+	region := l.region(cfg)
+	// clients are shared by the invokers with the same region and role
+	l.client = lambdaClient(region+"/"+l.role, func() *lambda.Client {
+		cred := cfg.Credentials
+		if l.role != "" {
+			stsClient := sts.NewFromConfig(cfg, func(o *sts.Options) {
+				if ep := awsEndpoint(EnvSTSEndpoint); ep != "" {
+					o.EndpointResolver = sts.EndpointResolverFromURL(ep)
+				}
+			})
+			cred = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(stsClient, l.role))
+		}
+		return lambda.NewFromConfig(cfg, func(o *lambda.Options) {
+			o.Region = region
+			o.Credentials = cred
+			if ep := awsEndpoint(EnvLambdaEndpoint); ep != "" {
+				o.EndpointResolver = lambda.EndpointResolverFromURL(ep)
+			}
+		})
 	})
 	return l.getConfig()
 }
@@ -165,7 +175,7 @@ func instanceMetadata() (*imds.GetInstanceIdentityDocumentOutput, *aws.Config, e
 		return nil, nil, err
 	}
 
-	cfg, err := awsConfig.LoadDefaultConfig(ctx, awsConfig.WithRegion(iid.Region))
+	cfg, err := loadAWSConfig(ctx, awsConfig.WithRegion(iid.Region))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -15,6 +15,7 @@ package mantil
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"net/http"
 
@@ -64,6 +65,12 @@ func newHandler(api interface{}) *lambdaHandler {
 // That defines Lambda handler around this Go struct:
 // https://github.com/mantil-io/template-excuses/blob/master/api/excuses/excuses.go
 //
+// Lambda function subscribed to the SQS queue calls OnQueue method for each
+// message in the event, with message body as the method argument, see Queue.
+// Event source mapping should have ReportBatchItemFailures enabled, so only
+// the messages with the method error are returned to the queue. Api without
+// OnQueue method receives whole event in the Default method.
+//
 // When used with API Gateway in Mantil application exported methods are exposed at URLs:
 //  Default - [root]/excuses
 //  Count   - [root]/excuses/count
@@ -102,7 +109,12 @@ func (h *lambdaHandler) invoke(ctx context.Context, payload []byte) (Request, re
 		return req, errResponse(err, http.StatusInternalServerError)
 	}
 
-	rsp := h.caller.call(reqCtx, req.Body, req.Params, req.Methods...)
+	var rsp response
+	if req.Type == SQS && h.caller.hasMethod(req.Methods[0]) {
+		rsp = h.invokeQueue(reqCtx, req)
+	} else {
+		rsp = h.caller.call(reqCtx, req.Body, req.Params, req.Methods...)
+	}
 	if err := rsp.Err(); err != nil {
 		info("invoke of method %v failed with error: %v", req.Methods, err)
 	}
@@ -112,6 +124,49 @@ func (h *lambdaHandler) invoke(ctx context.Context, payload []byte) (Request, re
 	return req, rsp
 }
 
+// sqsBatchResponse reports failed messages to the SQS event source.
+// Requires ReportBatchItemFailures in the event source mapping.
+type sqsBatchResponse struct {
+	BatchItemFailures []sqsBatchItemFailure `json:"batchItemFailures"`
+}
+
+type sqsBatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// invokeQueue calls OnQueue method with each message of the SQS event.
+// Only failed messages are returned to the queue. Messages of the FIFO queue
+// group after the first failed message of the group are not processed, to
+// keep the order.
+func (h *lambdaHandler) invokeQueue(ctx context.Context, req Request) response {
+	msgs, err := req.sqsMessages()
+	if err != nil {
+		return errResponse(err, http.StatusBadRequest)
+	}
+	br := sqsBatchResponse{BatchItemFailures: []sqsBatchItemFailure{}}
+	failedGroups := make(map[string]bool)
+	for _, m := range msgs {
+		group := m.Attributes["MessageGroupId"]
+		if group != "" && failedGroups[group] {
+			br.BatchItemFailures = append(br.BatchItemFailures, sqsBatchItemFailure{ItemIdentifier: m.MessageId})
+			continue
+		}
+		rsp := h.caller.call(ctx, []byte(m.Body), nil, req.Methods[0])
+		if err := rsp.Err(); err != nil {
+			info("queue message %s failed with error: %v", m.MessageId, err)
+			br.BatchItemFailures = append(br.BatchItemFailures, sqsBatchItemFailure{ItemIdentifier: m.MessageId})
+			if group != "" {
+				failedGroups[group] = true
+			}
+		}
+	}
+	payload, err := json.Marshal(br)
+	if err != nil {
+		return errResponse(err, http.StatusInternalServerError)
+	}
+	return okResponse(payload, br)
+}
+
 func (h *lambdaHandler) formatResponse(req Request, rsp response) ([]byte, error) {
 	switch req.Type {
 	case APIGateway:
@@ -0,0 +1,276 @@
+package mantil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqssvc "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// maximal number of messages in the SQS batch request
+const sendBatchSize = 10
+
+// maximal size of the messages in the SQS batch request, also the maximal
+// size of the single message
+const sendBatchBytes = 256 * 1024
+
+// number of attempts to send batch entries which failed without sender fault
+const sendBatchAttempts = 3
+
+// delay before the first retry of the failed batch entries, doubles after
+// each attempt
+var sendRetryDelay = 100 * time.Millisecond
+
+// Queue sends values of type T to the project SQS queue as JSON messages.
+// Lambda function subscribed to the queue receives decoded values in the
+// OnQueue method, see LambdaHandler.
+// Example:
+//   type Job struct {
+//   	ID string
+//   }
+//
+//   jobs, err := mantil.NewQueue[Job]("jobs")
+//   err = jobs.Send(ctx, Job{ID: "1"}, mantil.SendDelay(time.Minute))
+//
+//   // consumer Lambda function api
+//   func (a *Worker) OnQueue(ctx context.Context, job Job) error {
+//   	...
+//   }
+//
+type Queue[T any] struct {
+	client *sqssvc.Client
+	url    string
+	fifo   bool
+}
+
+// NewQueue creates queue (if it doesn't already exist) as SQSQueue.
+func NewQueue[T any](name string) (*Queue[T], error) {
+	return NewQueueWithOptions[T](name, QueueOptions{})
+}
+
+// NewQueueWithOptions creates queue (if it doesn't already exist) as
+// SQSQueueWithOptions.
+func NewQueueWithOptions[T any](name string, opts QueueOptions) (*Queue[T], error) {
+	client, url, err := SQSQueueWithOptions(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Queue[T]{client: client, url: url, fifo: opts.FIFO}, nil
+}
+
+// URL returns url of the SQS queue.
+func (q *Queue[T]) URL() string {
+	return q.url
+}
+
+// SendOption configures sending of the message.
+type SendOption func(*sendOptions)
+
+type sendOptions struct {
+	delay           time.Duration
+	groupID         string
+	deduplicationID string
+}
+
+// SendDelay delays delivery of the message, up to 15 minutes.
+// Not supported by FIFO queues.
+func SendDelay(d time.Duration) SendOption {
+	return func(o *sendOptions) {
+		o.delay = d
+	}
+}
+
+// SendGroupID sets message group of the FIFO queue message. Messages of
+// the same group are delivered in order. Required for FIFO queues.
+func SendGroupID(id string) SendOption {
+	return func(o *sendOptions) {
+		o.groupID = id
+	}
+}
+
+// SendDeduplicationID sets deduplication id of the FIFO queue message.
+// Messages with the same id sent in the 5 minutes interval are delivered
+// once. Required for FIFO queues without content based deduplication.
+func SendDeduplicationID(id string) SendOption {
+	return func(o *sendOptions) {
+		o.deduplicationID = id
+	}
+}
+
+func (q *Queue[T]) sendOptions(opts []SendOption) (*sendOptions, error) {
+	o := &sendOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if q.fifo && o.groupID == "" {
+		return nil, fmt.Errorf("group id is required for FIFO queue")
+	}
+	if q.fifo && o.delay > 0 {
+		return nil, fmt.Errorf("delay is not supported for FIFO queue")
+	}
+	if !q.fifo && (o.groupID != "" || o.deduplicationID != "") {
+		return nil, fmt.Errorf("group and deduplication ids are supported only for FIFO queue")
+	}
+	return o, nil
+}
+
+func (o *sendOptions) delaySeconds() int32 {
+	return int32(o.delay / time.Second)
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+// Send sends value to the queue.
+func (q *Queue[T]) Send(ctx context.Context, v T, opts ...SendOption) error {
+	o, err := q.sendOptions(opts)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = q.client.SendMessage(ctx, &sqssvc.SendMessageInput{
+		QueueUrl:               aws.String(q.url),
+		MessageBody:            aws.String(string(body)),
+		DelaySeconds:           o.delaySeconds(),
+		MessageGroupId:         optionalString(o.groupID),
+		MessageDeduplicationId: optionalString(o.deduplicationID),
+	})
+	if err != nil {
+		return fmt.Errorf("could not send message - %w", err)
+	}
+	return nil
+}
+
+// SendBatch sends values to the queue in batches of up to 10 messages and
+// 256 KB. Options apply to all messages. Deduplication id of each message is
+// suffixed with its index. Messages larger than 256 KB are not sent.
+// Messages which failed to send without the sender fault are retried with
+// backoff. If some of the messages are not sent returns ErrSendBatch with
+// their indexes. When the whole batch request fails sending stops and all
+// messages which are not sent yet are in the ErrSendBatch.
+func (q *Queue[T]) SendBatch(ctx context.Context, values []T, opts ...SendOption) error {
+	o, err := q.sendOptions(opts)
+	if err != nil {
+		return err
+	}
+	entries := make([]types.SendMessageBatchRequestEntry, 0, len(values))
+	berr := &ErrSendBatch{}
+	for i, v := range values {
+		body, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if len(body) > sendBatchBytes {
+			berr.add(i, fmt.Errorf("message size %d exceeds %d bytes", len(body), sendBatchBytes))
+			continue
+		}
+		e := types.SendMessageBatchRequestEntry{
+			Id:             aws.String(strconv.Itoa(i)),
+			MessageBody:    aws.String(string(body)),
+			DelaySeconds:   o.delaySeconds(),
+			MessageGroupId: optionalString(o.groupID),
+		}
+		if o.deduplicationID != "" {
+			e.MessageDeduplicationId = aws.String(fmt.Sprintf("%s-%d", o.deduplicationID, i))
+		}
+		entries = append(entries, e)
+	}
+	for len(entries) > 0 {
+		n := batchEntries(entries)
+		if unsent, err := q.sendBatch(ctx, entries[:n], berr); err != nil {
+			for _, e := range append(unsent, entries[n:]...) {
+				i, _ := strconv.Atoi(aws.ToString(e.Id))
+				berr.add(i, err)
+			}
+			return berr
+		}
+		entries = entries[n:]
+	}
+	if len(berr.failed) > 0 {
+		return berr
+	}
+	return nil
+}
+
+// batchEntries returns number of the first entries which fit into the
+// single batch request.
+func batchEntries(entries []types.SendMessageBatchRequestEntry) int {
+	size := 0
+	for i, e := range entries {
+		size += len(aws.ToString(e.MessageBody))
+		if i == sendBatchSize || (i > 0 && size > sendBatchBytes) {
+			return i
+		}
+	}
+	return len(entries)
+}
+
+// sendBatch sends up to 10 entries, failed entries are added to berr.
+// If the request fails returns entries which are not sent.
+func (q *Queue[T]) sendBatch(ctx context.Context, entries []types.SendMessageBatchRequestEntry, berr *ErrSendBatch) ([]types.SendMessageBatchRequestEntry, error) {
+	delay := sendRetryDelay
+	for attempt := 1; len(entries) > 0; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return entries, ctx.Err()
+			}
+			delay *= 2
+		}
+		out, err := q.client.SendMessageBatch(ctx, &sqssvc.SendMessageBatchInput{
+			QueueUrl: aws.String(q.url),
+			Entries:  entries,
+		})
+		if err != nil {
+			return entries, fmt.Errorf("could not send messages - %w", err)
+		}
+		var retry []types.SendMessageBatchRequestEntry
+		for _, f := range out.Failed {
+			i, _ := strconv.Atoi(aws.ToString(f.Id))
+			if f.SenderFault || attempt == sendBatchAttempts {
+				berr.add(i, fmt.Errorf("%s: %s", aws.ToString(f.Code), aws.ToString(f.Message)))
+				continue
+			}
+			for _, e := range entries {
+				if aws.ToString(e.Id) == aws.ToString(f.Id) {
+					retry = append(retry, e)
+				}
+			}
+		}
+		entries = retry
+	}
+	return nil, nil
+}
+
+// ErrSendBatch is returned when some of the messages in SendBatch are not sent.
+type ErrSendBatch struct {
+	failed []int
+	errs   []error
+}
+
+func (e *ErrSendBatch) add(i int, err error) {
+	e.failed = append(e.failed, i)
+	e.errs = append(e.errs, err)
+}
+
+// Failed returns indexes of the values which are not sent.
+func (e ErrSendBatch) Failed() []int {
+	return e.failed
+}
+
+func (e ErrSendBatch) Error() string {
+	return fmt.Sprintf("failed to send %d messages, first error: %v", len(e.failed), e.errs[0])
+}
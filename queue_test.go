@@ -0,0 +1,212 @@
+package mantil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqssvc "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueSendOptions(t *testing.T) {
+	q := &Queue[string]{}
+	o, err := q.sendOptions([]SendOption{SendDelay(90 * time.Second)})
+	require.NoError(t, err)
+	require.Equal(t, int32(90), o.delaySeconds())
+	_, err = q.sendOptions([]SendOption{SendGroupID("group")})
+	require.Error(t, err)
+
+	q.fifo = true
+	_, err = q.sendOptions(nil)
+	require.Error(t, err)
+	_, err = q.sendOptions([]SendOption{SendGroupID("group"), SendDelay(time.Second)})
+	require.Error(t, err)
+	o, err = q.sendOptions([]SendOption{SendGroupID("group"), SendDeduplicationID("id")})
+	require.NoError(t, err)
+	require.Equal(t, "group", o.groupID)
+	require.Equal(t, "id", o.deduplicationID)
+}
+
+func TestErrSendBatch(t *testing.T) {
+	e := &ErrSendBatch{}
+	e.add(3, errors.New("InternalError: try again"))
+	e.add(7, errors.New("InternalError: try again"))
+	var err error = e
+	var berr *ErrSendBatch
+	require.True(t, errors.As(err, &berr))
+	require.Equal(t, []int{3, 7}, berr.Failed())
+	require.Contains(t, err.Error(), "2 messages")
+}
+
+// testSQS is fake SQS which answers SendMessageBatch requests. Requests
+// with entry id in requestErrors fail, entry ids in failures fail the number
+// of times set.
+type testSQS struct {
+	mu            sync.Mutex
+	sent          []int
+	requests      int
+	failures      map[int]int
+	requestErrors map[int]bool
+}
+
+func (s *testSQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ids []int
+	for i := 1; ; i++ {
+		id := r.Form.Get(fmt.Sprintf("SendMessageBatchRequestEntry.%d.Id", i))
+		if id == "" {
+			break
+		}
+		n, _ := strconv.Atoi(id)
+		ids = append(ids, n)
+	}
+	for _, id := range ids {
+		if s.requestErrors[id] {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Receiver</Type><Code>InternalError</Code><Message>unavailable</Message></Error></ErrorResponse>`)
+			return
+		}
+	}
+	var b strings.Builder
+	b.WriteString(`<SendMessageBatchResponse><SendMessageBatchResult>`)
+	for _, id := range ids {
+		if s.failures[id] > 0 {
+			s.failures[id]--
+			fmt.Fprintf(&b, `<BatchResultErrorEntry><Id>%d</Id><SenderFault>false</SenderFault><Code>InternalError</Code><Message>try again</Message></BatchResultErrorEntry>`, id)
+			continue
+		}
+		s.sent = append(s.sent, id)
+		fmt.Fprintf(&b, `<SendMessageBatchResultEntry><Id>%d</Id><MessageId>%d</MessageId></SendMessageBatchResultEntry>`, id, id)
+	}
+	b.WriteString(`</SendMessageBatchResult></SendMessageBatchResponse>`)
+	fmt.Fprint(w, b.String())
+}
+
+func TestQueueSendBatchErrors(t *testing.T) {
+	defer func(d time.Duration) { sendRetryDelay = d }(sendRetryDelay)
+	sendRetryDelay = time.Millisecond
+
+	svc := &testSQS{
+		failures:      map[int]int{3: 1, 5: sendBatchAttempts},
+		requestErrors: map[int]bool{15: true},
+	}
+	srv := httptest.NewServer(svc)
+	defer srv.Close()
+	q := &Queue[int]{
+		client: sqssvc.New(sqssvc.Options{
+			Region:           "local",
+			Credentials:      aws.AnonymousCredentials{},
+			EndpointResolver: sqssvc.EndpointResolverFromURL(srv.URL),
+			Retryer:          aws.NopRetryer{},
+		}),
+		url: srv.URL + "/queue",
+	}
+	values := make([]int, 25)
+
+	err := q.SendBatch(context.Background(), values)
+	var berr *ErrSendBatch
+	require.True(t, errors.As(err, &berr))
+	// 3 is sent on retry, 5 fails on every attempt, second batch fails
+	// and the third is not sent
+	failed := []int{5}
+	for i := 10; i < 25; i++ {
+		failed = append(failed, i)
+	}
+	require.Equal(t, failed, berr.Failed())
+	require.Equal(t, []int{0, 1, 2, 4, 6, 7, 8, 9, 3}, svc.sent)
+}
+
+func TestBatchEntries(t *testing.T) {
+	entries := func(sizes ...int) []types.SendMessageBatchRequestEntry {
+		var es []types.SendMessageBatchRequestEntry
+		for _, s := range sizes {
+			es = append(es, types.SendMessageBatchRequestEntry{MessageBody: aws.String(strings.Repeat("x", s))})
+		}
+		return es
+	}
+	require.Equal(t, 3, batchEntries(entries(1, 1, 1)))
+	require.Equal(t, 10, batchEntries(entries(1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1)))
+	require.Equal(t, 2, batchEntries(entries(100*1024, 100*1024, 100*1024)))
+	require.Equal(t, 1, batchEntries(entries(sendBatchBytes, 1)))
+}
+
+func TestQueueSendBatchSize(t *testing.T) {
+	svc := &testSQS{}
+	srv := httptest.NewServer(svc)
+	defer srv.Close()
+	q := &Queue[string]{
+		client: sqssvc.New(sqssvc.Options{
+			Region:           "local",
+			Credentials:      aws.AnonymousCredentials{},
+			EndpointResolver: sqssvc.EndpointResolverFromURL(srv.URL),
+			Retryer:          aws.NopRetryer{},
+		}),
+		url: srv.URL + "/queue",
+	}
+	medium := strings.Repeat("x", 100*1024)
+	err := q.SendBatch(context.Background(), []string{medium, strings.Repeat("x", sendBatchBytes), medium, medium})
+	var berr *ErrSendBatch
+	require.True(t, errors.As(err, &berr))
+	require.Equal(t, []int{1}, berr.Failed())
+	require.Equal(t, []int{0, 2, 3}, svc.sent)
+	require.Equal(t, 2, svc.requests)
+}
+
+func TestQueue(t *testing.T) {
+	type job struct {
+		ID int
+	}
+	q, err := NewQueueWithOptions[job]("my-typed-queue", QueueOptions{FIFO: true, ContentBasedDeduplication: true})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, q.Send(ctx, job{ID: 0}, SendGroupID("jobs")))
+	var jobs []job
+	for i := 1; i <= 12; i++ {
+		jobs = append(jobs, job{ID: i})
+	}
+	require.NoError(t, q.SendBatch(ctx, jobs, SendGroupID("jobs")))
+
+	// approximate number of messages is eventually consistent, count received
+	received := 0
+	deadline := time.Now().Add(30 * time.Second)
+	for received < 13 && time.Now().Before(deadline) {
+		out, err := q.client.ReceiveMessage(ctx, &sqssvc.ReceiveMessageInput{
+			QueueUrl:            aws.String(q.URL()),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     1,
+		})
+		require.NoError(t, err)
+		for _, m := range out.Messages {
+			received++
+			_, err := q.client.DeleteMessage(ctx, &sqssvc.DeleteMessageInput{
+				QueueUrl:      aws.String(q.URL()),
+				ReceiptHandle: m.ReceiptHandle,
+			})
+			require.NoError(t, err)
+		}
+	}
+	require.Equal(t, 13, received)
+
+	// cleanup
+	_, err = q.client.DeleteQueue(ctx, &sqssvc.DeleteQueueInput{
+		QueueUrl: aws.String(q.URL()),
+	})
+	require.NoError(t, err)
+}
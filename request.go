@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"strings"
 
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/mantil-io/mantil.go/proto"
 )
 
@@ -19,6 +20,7 @@ const (
 	WSMessage
 	WSDisconnect
 	Streaming
+	SQS
 )
 
 // Request contains Lambda function request attributes.
@@ -27,6 +29,7 @@ const (
 //  * AWS Console - detected at Type Unknown
 //  * SDK         - detected as Type Unknown
 //  * Websocket API Gateway methods
+//  * SQS queue event source
 // Request contains most useful attributes regarding of calling method.
 type Request struct {
 	Type    RequestType
@@ -75,6 +78,9 @@ type requestAttributes struct {
 
 	// for use in aws lmabda console to avoid putting quoted json into body
 	RawRequest json.RawMessage `json:"req"`
+
+	// event source records, decoded only for the detected source
+	Records []json.RawMessage `json:"Records"`
 }
 
 func parseRequest(raw []byte) (req Request) {
@@ -140,6 +146,26 @@ func (r *Request) detectType() {
 		r.Type = Streaming
 		return
 	}
+	if len(r.attr.Records) > 0 {
+		var record struct {
+			EventSource string `json:"eventSource"`
+		}
+		if err := json.Unmarshal(r.attr.Records[0], &record); err == nil && record.EventSource == "aws:sqs" {
+			r.Type = SQS
+			return
+		}
+	}
+}
+
+// sqsMessages decodes records of the SQS event.
+func (r *Request) sqsMessages() ([]events.SQSMessage, error) {
+	msgs := make([]events.SQSMessage, len(r.attr.Records))
+	for i, rec := range r.attr.Records {
+		if err := json.Unmarshal(rec, &msgs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
 }
 
 func (r *Request) methods() []string {
@@ -150,6 +176,8 @@ func (r *Request) methods() []string {
 		return []string{"Disconnect", ""}
 	case WSMessage:
 		return []string{"Message", ""}
+	case SQS:
+		return []string{"OnQueue", ""}
 	default:
 		return []string{r.method()}
 	}
@@ -183,7 +211,7 @@ func (r *Request) body() []byte {
 	if len(r.attr.RawRequest) > 0 {
 		return r.attr.RawRequest
 	}
-	if r.Type == RequestTypeUnknown {
+	if r.Type == RequestTypeUnknown || r.Type == SQS {
 		return r.Raw
 	}
 	return nil
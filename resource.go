@@ -8,6 +8,10 @@ type ResourceInfo struct {
 	Name string
 	// Tags that are automatically added to the resource on creation
 	Tags map[string]string
+	// ARN and Type, service and resource type like dynamodb:table, of the
+	// existing resource returned by Resources
+	ARN  string
+	Type string
 }
 
 // Resource takes a user-defined resource name and returns a ResourceInfo struct
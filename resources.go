@@ -0,0 +1,264 @@
+package mantil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	taggingtypes "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+	s3svc "github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	snssvc "github.com/aws/aws-sdk-go-v2/service/sns"
+	sqssvc "github.com/aws/aws-sdk-go-v2/service/sqs"
+	ssmsvc "github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// Types of the resources returned by Resources:
+const (
+	ResourceTypeTable     = "dynamodb:table"
+	ResourceTypeBucket    = "s3:bucket"
+	ResourceTypeQueue     = "sqs:queue"
+	ResourceTypeTopic     = "sns:topic"
+	ResourceTypeParameter = "ssm:parameter"
+	ResourceTypeSecret    = "secretsmanager:secret"
+)
+
+// Resources lists all resources of the project stage, found by the tags
+// which are added to each resource on creation, see Resource. Includes
+// resources created by other means with the same tags, like Lambda
+// functions of the project.
+func Resources() ([]ResourceInfo, error) {
+	tags := config().ResourceTags
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("resource tags not found in config")
+	}
+	client, err := taggingClient()
+	if err != nil {
+		return nil, err
+	}
+	var filters []taggingtypes.TagFilter
+	for k, v := range tags {
+		filters = append(filters, taggingtypes.TagFilter{
+			Key:    aws.String(k),
+			Values: []string{v},
+		})
+	}
+	var ris []ResourceInfo
+	p := resourcegroupstaggingapi.NewGetResourcesPaginator(client, &resourcegroupstaggingapi.GetResourcesInput{
+		TagFilters: filters,
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("could not list resources - %w", err)
+		}
+		for _, m := range out.ResourceTagMappingList {
+			ri, err := resourceInfo(aws.ToString(m.ResourceARN))
+			if err != nil {
+				return nil, err
+			}
+			ri.Tags = make(map[string]string)
+			for _, t := range m.Tags {
+				ri.Tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+			}
+			ris = append(ris, ri)
+		}
+	}
+	return ris, nil
+}
+
+// resourceInfo parses resource type and name from the arn.
+func resourceInfo(resourceArn string) (ResourceInfo, error) {
+	a, err := arn.Parse(resourceArn)
+	if err != nil {
+		return ResourceInfo{}, err
+	}
+	ri := ResourceInfo{ARN: resourceArn}
+	switch a.Service {
+	case "s3":
+		ri.Type = ResourceTypeBucket
+		ri.Name = a.Resource
+	case "sqs":
+		ri.Type = ResourceTypeQueue
+		ri.Name = a.Resource
+	case "sns":
+		ri.Type = ResourceTypeTopic
+		ri.Name = a.Resource
+	default:
+		// type/name or type:name
+		i := strings.IndexAny(a.Resource, "/:")
+		if i < 0 {
+			ri.Type = a.Service
+			ri.Name = a.Resource
+			break
+		}
+		ri.Type = a.Service + ":" + a.Resource[:i]
+		ri.Name = a.Resource[i+1:]
+		if ri.Type == ResourceTypeParameter {
+			ri.Name = "/" + ri.Name
+		}
+	}
+	return ri, nil
+}
+
+// ResourceNamePrefix returns DestroyResources filter which selects
+// resources with the name prefix.
+func ResourceNamePrefix(prefix string) func(ResourceInfo) bool {
+	return func(ri ResourceInfo) bool {
+		return strings.HasPrefix(ri.Name, prefix)
+	}
+}
+
+// DestroyResources deletes project stage resources, returned by Resources,
+// which are selected by the filter, all if the filter is nil. Buckets are
+// emptied before deletion. Only the resource types created by mantil.go
+// are deleted, others are skipped.
+// Intended for the tests teardown, resources are otherwise deleted when the
+// project stage is destroyed.
+// Example:
+//   err := mantil.DestroyResources(mantil.ResourceNamePrefix(mantil.Resource("test-").Name))
+//
+func DestroyResources(filter func(ResourceInfo) bool) error {
+	ris, err := Resources()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, ri := range ris {
+		if filter != nil && !filter(ri) {
+			continue
+		}
+		if err := destroyResource(ri); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	clearVerified()
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to destroy %d resources, first error: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+func destroyResource(ri ResourceInfo) error {
+	ctx := context.Background()
+	switch ri.Type {
+	case ResourceTypeTable:
+		d, err := newDynamo()
+		if err != nil {
+			return err
+		}
+		_, err = d.client.DeleteTable(ctx, &dynamodb.DeleteTableInput{
+			TableName: aws.String(ri.Name),
+		})
+		return wrapDestroyErr(ri, err)
+	case ResourceTypeBucket:
+		s, err := newS3()
+		if err != nil {
+			return err
+		}
+		if err := s.emptyBucket(ri.Name); err != nil {
+			return wrapDestroyErr(ri, err)
+		}
+		_, err = s.client.DeleteBucket(ctx, &s3svc.DeleteBucketInput{
+			Bucket: aws.String(ri.Name),
+		})
+		return wrapDestroyErr(ri, err)
+	case ResourceTypeQueue:
+		s, err := newSQS()
+		if err != nil {
+			return err
+		}
+		url, err := s.queueURL(ri.Name)
+		if err != nil || url == "" {
+			return wrapDestroyErr(ri, err)
+		}
+		_, err = s.client.DeleteQueue(ctx, &sqssvc.DeleteQueueInput{
+			QueueUrl: aws.String(url),
+		})
+		return wrapDestroyErr(ri, err)
+	case ResourceTypeTopic:
+		s, err := newSNS()
+		if err != nil {
+			return err
+		}
+		_, err = s.client.DeleteTopic(ctx, &snssvc.DeleteTopicInput{
+			TopicArn: aws.String(ri.ARN),
+		})
+		return wrapDestroyErr(ri, err)
+	case ResourceTypeParameter:
+		s, err := newSSM()
+		if err != nil {
+			return err
+		}
+		_, err = s.client.DeleteParameter(ctx, &ssmsvc.DeleteParameterInput{
+			Name: aws.String(ri.Name),
+		})
+		return wrapDestroyErr(ri, err)
+	case ResourceTypeSecret:
+		client, err := secretsManagerClient()
+		if err != nil {
+			return err
+		}
+		_, err = client.DeleteSecret(ctx, &secretsmanager.DeleteSecretInput{
+			SecretId:                   aws.String(ri.ARN),
+			ForceDeleteWithoutRecovery: true,
+		})
+		return wrapDestroyErr(ri, err)
+	default:
+		info("skipping destroy of %s", ri.ARN)
+		return nil
+	}
+}
+
+func wrapDestroyErr(ri ResourceInfo, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("could not destroy %s %s - %w", ri.Type, ri.Name, err)
+}
+
+// emptyBucket deletes all objects in the bucket, including all versions.
+func (s *s3) emptyBucket(name string) error {
+	ctx := context.Background()
+	in := &s3svc.ListObjectVersionsInput{
+		Bucket: aws.String(name),
+	}
+	for {
+		out, err := s.client.ListObjectVersions(ctx, in)
+		if err != nil {
+			return err
+		}
+		var objects []s3types.ObjectIdentifier
+		for _, v := range out.Versions {
+			objects = append(objects, s3types.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+		}
+		for _, m := range out.DeleteMarkers {
+			objects = append(objects, s3types.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+		}
+		if len(objects) > 0 {
+			dout, err := s.client.DeleteObjects(ctx, &s3svc.DeleteObjectsInput{
+				Bucket: aws.String(name),
+				Delete: &s3types.Delete{Objects: objects, Quiet: true},
+			})
+			if err != nil {
+				return err
+			}
+			// quiet mode reports only objects which are not deleted
+			if len(dout.Errors) > 0 {
+				e := dout.Errors[0]
+				return fmt.Errorf("could not delete %d objects, first %s - %s: %s",
+					len(dout.Errors), aws.ToString(e.Key), aws.ToString(e.Code), aws.ToString(e.Message))
+			}
+		}
+		if !out.IsTruncated {
+			return nil
+		}
+		in.KeyMarker = out.NextKeyMarker
+		in.VersionIdMarker = out.NextVersionIdMarker
+	}
+}
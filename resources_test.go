@@ -0,0 +1,56 @@
+package mantil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceInfoFromARN(t *testing.T) {
+	cases := []struct {
+		arn  string
+		typ  string
+		name string
+	}{
+		{"arn:aws:dynamodb:eu-central-1:123456789012:table/mantil-go-unit-kv", ResourceTypeTable, "mantil-go-unit-kv"},
+		{"arn:aws:s3:::mantil-go-unit-bucket", ResourceTypeBucket, "mantil-go-unit-bucket"},
+		{"arn:aws:sqs:eu-central-1:123456789012:mantil-go-unit-queue.fifo", ResourceTypeQueue, "mantil-go-unit-queue.fifo"},
+		{"arn:aws:sns:eu-central-1:123456789012:mantil-go-unit-topic", ResourceTypeTopic, "mantil-go-unit-topic"},
+		{"arn:aws:ssm:eu-central-1:123456789012:parameter/mantil-go-unit-param", ResourceTypeParameter, "/mantil-go-unit-param"},
+		{"arn:aws:secretsmanager:eu-central-1:123456789012:secret:mantil-go-unit-secret-AbCdEf", ResourceTypeSecret, "mantil-go-unit-secret-AbCdEf"},
+		{"arn:aws:lambda:eu-central-1:123456789012:function:mantil-go-unit-ping", "lambda:function", "mantil-go-unit-ping"},
+	}
+	for _, c := range cases {
+		ri, err := resourceInfo(c.arn)
+		require.NoError(t, err)
+		require.Equal(t, c.arn, ri.ARN)
+		require.Equal(t, c.typ, ri.Type)
+		require.Equal(t, c.name, ri.Name)
+	}
+
+	_, err := resourceInfo("not-an-arn")
+	require.Error(t, err)
+}
+
+func TestResourceNamePrefix(t *testing.T) {
+	f := ResourceNamePrefix(Resource("").Name)
+	require.True(t, f(ResourceInfo{Name: Resource("kv").Name}))
+	require.False(t, f(ResourceInfo{Name: "other-kv"}))
+}
+
+func TestDestroyResources(t *testing.T) {
+	_, _, err := SSMParameter("destroy-test", "value")
+	require.NoError(t, err)
+
+	name := ssmParameterName("destroy-test")
+	err = DestroyResources(func(ri ResourceInfo) bool {
+		return ri.Name == name
+	})
+	require.NoError(t, err)
+
+	ris, err := Resources()
+	require.NoError(t, err)
+	for _, ri := range ris {
+		require.NotEqual(t, name, ri.Name)
+	}
+}
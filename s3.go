@@ -6,32 +6,45 @@ import (
 	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	s3svc "github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go"
 )
 
 type s3 struct {
-	region string
-	client *s3svc.Client
+	region      string
+	client      *s3svc.Client
+	credentials aws.CredentialsProvider
 }
 
+// newS3 returns S3 client shared in the process.
 func newS3() (*s3, error) {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	if awsClients.s3 != nil {
+		return awsClients.s3, nil
+	}
 	s3 := &s3{}
 	if err := s3.init(); err != nil {
 		return nil, err
 	}
+	awsClients.s3 = s3
 	return s3, nil
 }
 
 func (s *s3) init() error {
-	cfg, err := awsConfig.LoadDefaultConfig(context.TODO())
+	cfg, err := loadAWSConfig(context.TODO())
 	if err != nil {
-		return fmt.Errorf("unable to load SDK config, %w", err)
+		return err
 	}
-	s.client = s3svc.NewFromConfig(cfg)
+	s.client = s3svc.NewFromConfig(cfg, func(o *s3svc.Options) {
+		if ep := awsEndpoint(EnvS3Endpoint); ep != "" {
+			o.EndpointResolver = s3svc.EndpointResolverFromURL(ep)
+			o.UsePathStyle = true
+		}
+	})
 	s.region = cfg.Region
+	s.credentials = cfg.Credentials
 	return nil
 }
 
@@ -56,7 +69,217 @@ func S3Bucket(name string) (*s3svc.Client, error) {
 	return s3.client, nil
 }
 
+// BucketOptions describes settings of the bucket created by
+// S3BucketWithOptions. Zero value leaves the setting unchanged.
+type BucketOptions struct {
+	// Versioning enables object versioning.
+	Versioning bool
+	// Encryption enables default server side encryption with S3 managed keys
+	// (SSE-S3), or with the KMS key if KMSKeyID is set (SSE-KMS).
+	Encryption bool
+	KMSKeyID   string
+	// Expiration rules delete objects under the prefix after the number of
+	// days, e.g. temporary uploads.
+	Expiration []BucketExpiration
+	// CORS rules allow browser access to the bucket, e.g. uploads with
+	// presigned URLs.
+	CORS []BucketCORSRule
+	// BlockPublicAccess blocks all public access to the bucket and objects.
+	BlockPublicAccess bool
+}
+
+// BucketExpiration expires objects under the Prefix after Days.
+type BucketExpiration struct {
+	Prefix string
+	Days   int
+}
+
+// BucketCORSRule is a CORS rule of the bucket.
+type BucketCORSRule struct {
+	AllowedOrigins []string
+	// AllowedMethods are GET, PUT, POST, DELETE or HEAD.
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposeHeaders  []string
+	MaxAgeSeconds  int
+}
+
+// S3BucketWithOptions creates a new S3 bucket (if it doesn't already exist)
+// as S3Bucket and applies the settings from options.
+//
+// Settings are applied on each call so the existing bucket is reconciled with
+// the options. Expiration and CORS rules replace current rules of the bucket.
+// Settings not enabled in the options are not removed from the bucket.
+// Example:
+//   client, err := mantil.S3BucketWithOptions("uploads", mantil.BucketOptions{
+//   	Versioning: true,
+//   	Encryption: true,
+//   	Expiration: []mantil.BucketExpiration{{Prefix: "tmp/", Days: 1}},
+//   	CORS: []mantil.BucketCORSRule{{
+//   		AllowedOrigins: []string{"https://example.com"},
+//   		AllowedMethods: []string{"GET", "PUT"},
+//   		AllowedHeaders: []string{"*"},
+//   	}},
+//   	BlockPublicAccess: true,
+//   })
+//
+func S3BucketWithOptions(name string, opts BucketOptions) (*s3svc.Client, error) {
+	if err := opts.validate(); err != nil {
+		return nil, fmt.Errorf("invalid bucket %s options, %w", name, err)
+	}
+	s3, err := newS3()
+	if err != nil {
+		return nil, err
+	}
+	r := Resource(name)
+	if err := s3.createBucket(r.Name); err != nil {
+		return nil, err
+	}
+	// options are applied once per process
+	resource := fmt.Sprintf("bucket/%s/%v", r.Name, opts)
+	if isVerified(resource) {
+		return s3.client, nil
+	}
+	if err := s3.applyBucketOptions(r.Name, opts); err != nil {
+		return nil, err
+	}
+	setVerified(resource)
+	return s3.client, nil
+}
+
+func (o BucketOptions) validate() error {
+	if o.KMSKeyID != "" && !o.Encryption {
+		return fmt.Errorf("kms key requires encryption")
+	}
+	for _, e := range o.Expiration {
+		if e.Days <= 0 {
+			return fmt.Errorf("expiration of prefix %s must be at least one day", e.Prefix)
+		}
+	}
+	for _, r := range o.CORS {
+		if len(r.AllowedOrigins) == 0 || len(r.AllowedMethods) == 0 {
+			return fmt.Errorf("cors rule requires allowed origins and methods")
+		}
+	}
+	return nil
+}
+
+func (s *s3) applyBucketOptions(name string, opts BucketOptions) error {
+	ctx := context.Background()
+	if opts.BlockPublicAccess {
+		if _, err := s.client.PutPublicAccessBlock(ctx, &s3svc.PutPublicAccessBlockInput{
+			Bucket: aws.String(name),
+			PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+				BlockPublicAcls:       true,
+				BlockPublicPolicy:     true,
+				IgnorePublicAcls:      true,
+				RestrictPublicBuckets: true,
+			},
+		}); err != nil {
+			return fmt.Errorf("could not block public access to bucket %s - %w", name, err)
+		}
+	}
+	if opts.Versioning {
+		if _, err := s.client.PutBucketVersioning(ctx, &s3svc.PutBucketVersioningInput{
+			Bucket: aws.String(name),
+			VersioningConfiguration: &types.VersioningConfiguration{
+				Status: types.BucketVersioningStatusEnabled,
+			},
+		}); err != nil {
+			return fmt.Errorf("could not enable versioning of bucket %s - %w", name, err)
+		}
+	}
+	if opts.Encryption {
+		if _, err := s.client.PutBucketEncryption(ctx, &s3svc.PutBucketEncryptionInput{
+			Bucket:                            aws.String(name),
+			ServerSideEncryptionConfiguration: opts.encryptionConfiguration(),
+		}); err != nil {
+			return fmt.Errorf("could not enable encryption of bucket %s - %w", name, err)
+		}
+	}
+	if len(opts.Expiration) > 0 {
+		if _, err := s.client.PutBucketLifecycleConfiguration(ctx, &s3svc.PutBucketLifecycleConfigurationInput{
+			Bucket:                 aws.String(name),
+			LifecycleConfiguration: opts.lifecycleConfiguration(),
+		}); err != nil {
+			return fmt.Errorf("could not set lifecycle of bucket %s - %w", name, err)
+		}
+	}
+	if len(opts.CORS) > 0 {
+		if _, err := s.client.PutBucketCors(ctx, &s3svc.PutBucketCorsInput{
+			Bucket:            aws.String(name),
+			CORSConfiguration: opts.corsConfiguration(),
+		}); err != nil {
+			return fmt.Errorf("could not set cors of bucket %s - %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (o BucketOptions) encryptionConfiguration() *types.ServerSideEncryptionConfiguration {
+	sse := &types.ServerSideEncryptionByDefault{
+		SSEAlgorithm: types.ServerSideEncryptionAes256,
+	}
+	if o.KMSKeyID != "" {
+		sse.SSEAlgorithm = types.ServerSideEncryptionAwsKms
+		sse.KMSMasterKeyID = aws.String(o.KMSKeyID)
+	}
+	return &types.ServerSideEncryptionConfiguration{
+		Rules: []types.ServerSideEncryptionRule{
+			{
+				ApplyServerSideEncryptionByDefault: sse,
+				BucketKeyEnabled:                   o.KMSKeyID != "",
+			},
+		},
+	}
+}
+
+func (o BucketOptions) lifecycleConfiguration() *types.BucketLifecycleConfiguration {
+	var rules []types.LifecycleRule
+	for _, e := range o.Expiration {
+		rules = append(rules, types.LifecycleRule{
+			ID:         aws.String(fmt.Sprintf("expire-%s-%d", e.Prefix, e.Days)),
+			Status:     types.ExpirationStatusEnabled,
+			Filter:     &types.LifecycleRuleFilterMemberPrefix{Value: e.Prefix},
+			Expiration: &types.LifecycleExpiration{Days: int32(e.Days)},
+			// incomplete multipart uploads are not visible as objects
+			AbortIncompleteMultipartUpload: &types.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: int32(e.Days),
+			},
+		})
+	}
+	return &types.BucketLifecycleConfiguration{Rules: rules}
+}
+
+func (o BucketOptions) corsConfiguration() *types.CORSConfiguration {
+	var rules []types.CORSRule
+	for _, r := range o.CORS {
+		rules = append(rules, types.CORSRule{
+			AllowedOrigins: r.AllowedOrigins,
+			AllowedMethods: r.AllowedMethods,
+			AllowedHeaders: r.AllowedHeaders,
+			ExposeHeaders:  r.ExposeHeaders,
+			MaxAgeSeconds:  int32(r.MaxAgeSeconds),
+		})
+	}
+	return &types.CORSConfiguration{CORSRules: rules}
+}
+
+// createBucket creates bucket if it doesn't exist. Bucket is checked once
+// per process.
 func (s *s3) createBucket(name string) error {
+	resource := "bucket/" + name
+	if isVerified(resource) {
+		return nil
+	}
+	if err := s.ensureBucket(name); err != nil {
+		return err
+	}
+	setVerified(resource)
+	return nil
+}
+
+func (s *s3) ensureBucket(name string) error {
 	exists, err := s.bucketExists(name)
 	if err != nil {
 		return fmt.Errorf("error checking if bucket %s exists - %w", name, err)
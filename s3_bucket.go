@@ -0,0 +1,417 @@
+package mantil
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3svc "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// default expiration of the presigned requests
+const presignExpires = 15 * time.Minute
+
+// minimal size of the multipart upload part, except the last one
+const multipartPartSize = 5 * 1024 * 1024
+
+// Bucket is a project S3 bucket with helpers for presigned requests and
+// streaming uploads.
+type Bucket struct {
+	name string
+	s3   *s3
+}
+
+// NewBucket creates a new S3 bucket (if it doesn't already exist) as
+// S3Bucket. Name is a Mantil project resource name, see Resource.
+// Example:
+//   b, err := mantil.NewBucket("uploads")
+//   // url for the browser upload
+//   req, err := b.PresignPut("images/1.png", mantil.PresignOptions{ContentType: "image/png"})
+//
+func NewBucket(name string) (*Bucket, error) {
+	s, err := newS3()
+	if err != nil {
+		return nil, err
+	}
+	r := Resource(name)
+	if err := s.createBucket(r.Name); err != nil {
+		return nil, err
+	}
+	return &Bucket{name: r.Name, s3: s}, nil
+}
+
+// Name returns full name of the AWS bucket.
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+// Client returns S3 client for the other operations on the bucket.
+func (b *Bucket) Client() *s3svc.Client {
+	return b.s3.client
+}
+
+// PresignOptions are constraints of the presigned request.
+type PresignOptions struct {
+	// Expires is validity of the request, default 15 minutes.
+	Expires time.Duration
+	// ContentType of the uploaded object. Client must send the same
+	// Content-Type header.
+	ContentType string
+	// Size is the exact size of the object uploaded with PresignPut.
+	// Client must send the same Content-Length header.
+	Size int64
+	// MinSize and MaxSize limit size of the object uploaded with
+	// PresignPost.
+	MinSize int64
+	MaxSize int64
+}
+
+func (o PresignOptions) expires() time.Duration {
+	if o.Expires <= 0 {
+		return presignExpires
+	}
+	return o.Expires
+}
+
+// PresignedRequest is a request which can be made without AWS credentials,
+// e.g. from the browser.
+type PresignedRequest struct {
+	URL    string
+	Method string
+	// Header which must be sent with the request.
+	Header http.Header
+}
+
+// PresignGet creates presigned request for download of the object.
+func (b *Bucket) PresignGet(key string, opts PresignOptions) (*PresignedRequest, error) {
+	pc := s3svc.NewPresignClient(b.s3.client, s3svc.WithPresignExpires(opts.expires()))
+	req, err := pc.PresignGetObject(context.Background(), &s3svc.GetObjectInput{
+		Bucket: aws.String(b.name),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not presign get of %s - %w", key, err)
+	}
+	return &PresignedRequest{URL: req.URL, Method: req.Method, Header: req.SignedHeader}, nil
+}
+
+// PresignPut creates presigned request for upload of the object.
+// ContentType and Size options are signed, client must send the same
+// Content-Type and Content-Length headers. Use PresignPost to limit size of
+// the object to the range.
+func (b *Bucket) PresignPut(key string, opts PresignOptions) (*PresignedRequest, error) {
+	if opts.MinSize > 0 || opts.MaxSize > 0 {
+		return nil, fmt.Errorf("size range can't be signed in the PUT request, use Size option or PresignPost")
+	}
+	in := &s3svc.PutObjectInput{
+		Bucket: aws.String(b.name),
+		Key:    aws.String(key),
+	}
+	if opts.ContentType != "" {
+		in.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.Size > 0 {
+		in.ContentLength = opts.Size
+	}
+	pc := s3svc.NewPresignClient(b.s3.client, s3svc.WithPresignExpires(opts.expires()))
+	req, err := pc.PresignPutObject(context.Background(), in)
+	if err != nil {
+		return nil, fmt.Errorf("could not presign put of %s - %w", key, err)
+	}
+	return &PresignedRequest{URL: req.URL, Method: req.Method, Header: req.SignedHeader}, nil
+}
+
+// PresignedPost is a presigned browser form upload. Form is sent to the URL
+// as multipart/form-data with all Fields followed by the file field.
+type PresignedPost struct {
+	URL    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+// PresignPost creates presigned form upload of the object. Unlike
+// PresignPut it can limit object size to the range between MinSize and
+// MaxSize. Size option is not used.
+// Example:
+//   post, err := b.PresignPost("uploads/report.pdf", mantil.PresignOptions{
+//   	ContentType: "application/pdf",
+//   	MaxSize:     10 * 1024 * 1024,
+//   })
+//   // browser:
+//   // const form = new FormData()
+//   // Object.entries(post.fields).forEach(([k, v]) => form.append(k, v))
+//   // form.append("file", file)
+//   // fetch(post.url, {method: "POST", body: form})
+//
+func (b *Bucket) PresignPost(key string, opts PresignOptions) (*PresignedPost, error) {
+	creds, err := b.s3.credentials.Retrieve(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve credentials - %w", err)
+	}
+	post, err := presignPost(b.name, b.s3.region, key, opts, creds, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if post.URL, err = b.postURL(key); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// postURL returns bucket URL resolved by the S3 client, so the custom
+// endpoints are respected. URL is taken from the presigned get of the key.
+func (b *Bucket) postURL(key string) (string, error) {
+	req, err := s3svc.NewPresignClient(b.s3.client).PresignGetObject(context.Background(), &s3svc.GetObjectInput{
+		Bucket: aws.String(b.name),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not resolve bucket url - %w", err)
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = strings.TrimSuffix(u.Path, key)
+	u.RawPath = ""
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// presignPost creates form fields with the policy signed with AWS Signature
+// Version 4:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-HTTPPOSTConstructPolicy.html
+func presignPost(bucket, region, key string, opts PresignOptions, creds aws.Credentials, now time.Time) (*PresignedPost, error) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	credential := fmt.Sprintf("%s/%s/%s/s3/aws4_request", creds.AccessKeyID, date, region)
+	fields := map[string]string{
+		"key":              key,
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": credential,
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+	}
+	if opts.ContentType != "" {
+		fields["Content-Type"] = opts.ContentType
+	}
+
+	conditions := []interface{}{
+		map[string]string{"bucket": bucket},
+	}
+	names := make([]string, 0, len(fields))
+	for k := range fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		conditions = append(conditions, []string{"eq", "$" + k, fields[k]})
+	}
+	if opts.MinSize > 0 || opts.MaxSize > 0 {
+		max := opts.MaxSize
+		if max <= 0 {
+			max = 5 * 1024 * 1024 * 1024
+		}
+		conditions = append(conditions, []interface{}{"content-length-range", opts.MinSize, max})
+	}
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": now.Add(opts.expires()).Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(policy)
+	fields["policy"] = encoded
+
+	sk := signingKey(creds.SecretAccessKey, date, region, "s3")
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(sk, encoded))
+
+	return &PresignedPost{
+		URL:    fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", bucket, region),
+		Fields: fields,
+	}, nil
+}
+
+// signingKey derives Signature Version 4 signing key.
+func signingKey(secret, date, region, service string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, v := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+	return key
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Writer returns writer which streams object to the bucket using multipart
+// upload. Data is uploaded in 5MB parts as it is written, so the size of
+// the object is not limited by the function memory. Object is created on
+// Close. Abort cancels the upload.
+// Example:
+//   w := b.Writer("exports/all.json", "application/json")
+//   if err := kv.ExportAll(w); err != nil {
+//   	w.Abort()
+//   	return err
+//   }
+//   return w.Close()
+//
+func (b *Bucket) Writer(key, contentType string) *BucketWriter {
+	return &BucketWriter{
+		bucket:      b,
+		key:         key,
+		contentType: contentType,
+	}
+}
+
+// BucketWriter uploads object to the bucket, see Bucket.Writer.
+type BucketWriter struct {
+	bucket      *Bucket
+	key         string
+	contentType string
+	meta        map[string]string
+
+	buf      bytes.Buffer
+	uploadID *string
+	parts    []types.CompletedPart
+	err      error
+	closed   bool
+}
+
+// Write buffers p and uploads full parts.
+func (w *BucketWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.closed {
+		return 0, fmt.Errorf("write to closed writer")
+	}
+	n, _ := w.buf.Write(p)
+	for w.buf.Len() >= multipartPartSize {
+		if err := w.uploadPart(w.buf.Next(multipartPartSize)); err != nil {
+			return n, w.fail(err)
+		}
+	}
+	return n, nil
+}
+
+// Close uploads the rest of the data and creates the object.
+// Objects smaller than the part size are uploaded in a single request.
+func (w *BucketWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	ctx := context.Background()
+	if w.uploadID == nil {
+		in := &s3svc.PutObjectInput{
+			Bucket:   aws.String(w.bucket.name),
+			Key:      aws.String(w.key),
+			Body:     bytes.NewReader(w.buf.Bytes()),
+			Metadata: w.meta,
+		}
+		if w.contentType != "" {
+			in.ContentType = aws.String(w.contentType)
+		}
+		if _, err := w.bucket.s3.client.PutObject(ctx, in); err != nil {
+			w.err = fmt.Errorf("could not upload %s - %w", w.key, err)
+		}
+		return w.err
+	}
+	if w.buf.Len() > 0 {
+		if err := w.uploadPart(w.buf.Bytes()); err != nil {
+			return w.fail(err)
+		}
+	}
+	_, err := w.bucket.s3.client.CompleteMultipartUpload(ctx, &s3svc.CompleteMultipartUploadInput{
+		Bucket:          aws.String(w.bucket.name),
+		Key:             aws.String(w.key),
+		UploadId:        w.uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: w.parts},
+	})
+	if err != nil {
+		return w.fail(fmt.Errorf("could not complete upload of %s - %w", w.key, err))
+	}
+	return nil
+}
+
+// Abort cancels the upload, uploaded parts are removed.
+func (w *BucketWriter) Abort() error {
+	w.closed = true
+	if w.err == nil {
+		w.err = fmt.Errorf("upload of %s aborted", w.key)
+	}
+	return w.abort()
+}
+
+func (w *BucketWriter) uploadPart(p []byte) error {
+	ctx := context.Background()
+	if w.uploadID == nil {
+		in := &s3svc.CreateMultipartUploadInput{
+			Bucket:   aws.String(w.bucket.name),
+			Key:      aws.String(w.key),
+			Metadata: w.meta,
+		}
+		if w.contentType != "" {
+			in.ContentType = aws.String(w.contentType)
+		}
+		out, err := w.bucket.s3.client.CreateMultipartUpload(ctx, in)
+		if err != nil {
+			return fmt.Errorf("could not start upload of %s - %w", w.key, err)
+		}
+		w.uploadID = out.UploadId
+	}
+	num := int32(len(w.parts) + 1)
+	out, err := w.bucket.s3.client.UploadPart(ctx, &s3svc.UploadPartInput{
+		Bucket:     aws.String(w.bucket.name),
+		Key:        aws.String(w.key),
+		UploadId:   w.uploadID,
+		PartNumber: num,
+		Body:       bytes.NewReader(p),
+	})
+	if err != nil {
+		return fmt.Errorf("could not upload part %d of %s - %w", num, w.key, err)
+	}
+	w.parts = append(w.parts, types.CompletedPart{ETag: out.ETag, PartNumber: num})
+	return nil
+}
+
+// fail stores the first error and aborts the upload.
+func (w *BucketWriter) fail(err error) error {
+	w.err = err
+	_ = w.abort()
+	return err
+}
+
+func (w *BucketWriter) abort() error {
+	if w.uploadID == nil {
+		return nil
+	}
+	_, err := w.bucket.s3.client.AbortMultipartUpload(context.Background(), &s3svc.AbortMultipartUploadInput{
+		Bucket:   aws.String(w.bucket.name),
+		Key:      aws.String(w.key),
+		UploadId: w.uploadID,
+	})
+	w.uploadID = nil
+	return err
+}
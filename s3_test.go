@@ -6,6 +6,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	s3svc "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -39,3 +40,73 @@ func TestS3BucketCreation(t *testing.T) {
 	})
 	require.Nil(t, err)
 }
+
+func TestBucketOptions(t *testing.T) {
+	require.NoError(t, BucketOptions{}.validate())
+	require.Error(t, BucketOptions{KMSKeyID: "key"}.validate())
+	require.Error(t, BucketOptions{Expiration: []BucketExpiration{{Prefix: "tmp/"}}}.validate())
+	require.Error(t, BucketOptions{CORS: []BucketCORSRule{{AllowedMethods: []string{"GET"}}}}.validate())
+
+	opts := BucketOptions{
+		Encryption: true,
+		Expiration: []BucketExpiration{{Prefix: "tmp/", Days: 1}, {Prefix: "logs/", Days: 30}},
+		CORS: []BucketCORSRule{{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"PUT"},
+			MaxAgeSeconds:  3600,
+		}},
+	}
+	require.NoError(t, opts.validate())
+
+	sse := opts.encryptionConfiguration().Rules[0]
+	require.Equal(t, types.ServerSideEncryptionAes256, sse.ApplyServerSideEncryptionByDefault.SSEAlgorithm)
+	require.Nil(t, sse.ApplyServerSideEncryptionByDefault.KMSMasterKeyID)
+	opts.KMSKeyID = "key"
+	sse = opts.encryptionConfiguration().Rules[0]
+	require.Equal(t, types.ServerSideEncryptionAwsKms, sse.ApplyServerSideEncryptionByDefault.SSEAlgorithm)
+	require.Equal(t, "key", *sse.ApplyServerSideEncryptionByDefault.KMSMasterKeyID)
+	require.True(t, sse.BucketKeyEnabled)
+
+	lc := opts.lifecycleConfiguration()
+	require.Len(t, lc.Rules, 2)
+	require.Equal(t, "tmp/", lc.Rules[0].Filter.(*types.LifecycleRuleFilterMemberPrefix).Value)
+	require.Equal(t, int32(30), lc.Rules[1].Expiration.Days)
+	require.NotEqual(t, *lc.Rules[0].ID, *lc.Rules[1].ID)
+
+	cors := opts.corsConfiguration()
+	require.Len(t, cors.CORSRules, 1)
+	require.Equal(t, int32(3600), cors.CORSRules[0].MaxAgeSeconds)
+}
+
+func TestS3BucketWithOptions(t *testing.T) {
+	name := "my-bucket-with-options"
+	opts := BucketOptions{
+		Versioning:        true,
+		Encryption:        true,
+		Expiration:        []BucketExpiration{{Prefix: "tmp/", Days: 1}},
+		BlockPublicAccess: true,
+	}
+	c, err := S3BucketWithOptions(name, opts)
+	require.Nil(t, err)
+	// applying options to the existing bucket is idempotent
+	_, err = S3BucketWithOptions(name, opts)
+	require.Nil(t, err)
+
+	r := Resource(name)
+	v, err := c.GetBucketVersioning(context.Background(), &s3svc.GetBucketVersioningInput{
+		Bucket: aws.String(r.Name),
+	})
+	require.Nil(t, err)
+	require.Equal(t, types.BucketVersioningStatusEnabled, v.Status)
+	lc, err := c.GetBucketLifecycleConfiguration(context.Background(), &s3svc.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(r.Name),
+	})
+	require.Nil(t, err)
+	require.Len(t, lc.Rules, 1)
+
+	// cleanup
+	_, err = c.DeleteBucket(context.Background(), &s3svc.DeleteBucketInput{
+		Bucket: aws.String(r.Name),
+	})
+	require.Nil(t, err)
+}
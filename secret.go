@@ -0,0 +1,212 @@
+package mantil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	ssmsvc "github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// default time for which secret values are cached
+const defaultSecretCacheTTL = 5 * time.Minute
+
+// SecretProvider reads values of the secrets and parameters.
+// Names are Mantil project resource names, see Resource.
+type SecretProvider interface {
+	Secret(name string) (string, error)
+	Param(name string) (string, error)
+}
+
+var secrets = struct {
+	sync.Mutex
+	provider SecretProvider
+}{}
+
+// SetSecretProvider changes provider used by Secret and Param functions.
+// By default AWS Secrets Manager and SSM Parameter Store are used, or
+// LocalSecretProvider when running tests or if MANTIL_SECRETS_FILE
+// environment variable is set.
+func SetSecretProvider(p SecretProvider) {
+	secrets.Lock()
+	defer secrets.Unlock()
+	secrets.provider = p
+}
+
+func secretProvider() SecretProvider {
+	secrets.Lock()
+	defer secrets.Unlock()
+	if secrets.provider == nil {
+		if _, ok := os.LookupEnv(EnvSecretsFile); ok || config().isUnitTestEnv() {
+			secrets.provider = NewLocalSecretProvider()
+		} else {
+			secrets.provider = NewAWSSecretProvider(defaultSecretCacheTTL)
+		}
+	}
+	return secrets.provider
+}
+
+// Secret returns value of the secret from the AWS Secrets Manager.
+// Secret name is the Mantil resource name, see Resource, so each project
+// stage has its own secrets.
+// Values are cached for 5 minutes across warm Lambda invocations.
+// Example:
+//   password, err := mantil.Secret("db-password")
+//
+func Secret(name string) (string, error) {
+	return secretProvider().Secret(name)
+}
+
+// SecretJSON decodes JSON value of the secret into v.
+// Example:
+//   var db struct {
+//   	Username string `json:"username"`
+//   	Password string `json:"password"`
+//   }
+//   err := mantil.SecretJSON("db", &db)
+//
+func SecretJSON(name string, v interface{}) error {
+	val, err := Secret(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(val), v); err != nil {
+		return fmt.Errorf("failed to decode secret %s, %w", name, err)
+	}
+	return nil
+}
+
+// Param returns value of the parameter from the SSM Parameter Store.
+// Parameter name is the Mantil resource name prefixed with slash, as in
+// SSMParameter. SecureString values are decrypted.
+// Values are cached for 5 minutes across warm Lambda invocations.
+func Param(name string) (string, error) {
+	return secretProvider().Param(name)
+}
+
+// ParamJSON decodes JSON value of the parameter into v.
+func ParamJSON(name string, v interface{}) error {
+	val, err := Param(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(val), v); err != nil {
+		return fmt.Errorf("failed to decode parameter %s, %w", name, err)
+	}
+	return nil
+}
+
+// ErrSecretNotFound is returned when secret or parameter with that name is not found.
+type ErrSecretNotFound struct {
+	name string
+}
+
+func (e ErrSecretNotFound) Error() string {
+	return fmt.Sprintf("secret or parameter: %s not found", e.name)
+}
+
+// AWSSecretProvider reads secrets from the AWS Secrets Manager and
+// parameters from the SSM Parameter Store. Values are cached for the TTL.
+type AWSSecretProvider struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	cache map[string]secretValue
+}
+
+type secretValue struct {
+	value   string
+	expires time.Time
+}
+
+// NewAWSSecretProvider creates provider which caches values for the ttl.
+// Values are not cached if ttl is zero.
+func NewAWSSecretProvider(ttl time.Duration) *AWSSecretProvider {
+	return &AWSSecretProvider{
+		ttl:   ttl,
+		cache: make(map[string]secretValue),
+	}
+}
+
+// Secret implements SecretProvider interface.
+func (p *AWSSecretProvider) Secret(name string) (string, error) {
+	return p.cached("secret/"+name, func() (string, error) {
+		return p.secret(name)
+	})
+}
+
+// Param implements SecretProvider interface.
+func (p *AWSSecretProvider) Param(name string) (string, error) {
+	return p.cached("param/"+name, func() (string, error) {
+		return p.param(name)
+	})
+}
+
+func (p *AWSSecretProvider) cached(key string, get func() (string, error)) (string, error) {
+	p.mu.Lock()
+	v, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && time.Now().Before(v.expires) {
+		return v.value, nil
+	}
+	val, err := get()
+	if err != nil {
+		return "", err
+	}
+	if p.ttl > 0 {
+		p.mu.Lock()
+		p.cache[key] = secretValue{value: val, expires: time.Now().Add(p.ttl)}
+		p.mu.Unlock()
+	}
+	return val, nil
+}
+
+func (p *AWSSecretProvider) secret(name string) (string, error) {
+	client, err := secretsManagerClient()
+	if err != nil {
+		return "", err
+	}
+	id := Resource(name).Name
+	out, err := client.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		var rnf *smtypes.ResourceNotFoundException
+		if errors.As(err, &rnf) {
+			return "", &ErrSecretNotFound{name: id}
+		}
+		return "", fmt.Errorf("could not get secret %s - %w", id, err)
+	}
+	if out.SecretString != nil {
+		return aws.ToString(out.SecretString), nil
+	}
+	return string(out.SecretBinary), nil
+}
+
+func (p *AWSSecretProvider) param(name string) (string, error) {
+	s, err := newSSM()
+	if err != nil {
+		return "", err
+	}
+	pn := ssmParameterName(name)
+	out, err := s.client.GetParameter(context.Background(), &ssmsvc.GetParameterInput{
+		Name:           aws.String(pn),
+		WithDecryption: true,
+	})
+	if err != nil {
+		var pnf *ssmtypes.ParameterNotFound
+		if errors.As(err, &pnf) {
+			return "", &ErrSecretNotFound{name: pn}
+		}
+		return "", fmt.Errorf("could not get parameter %s - %w", pn, err)
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
@@ -0,0 +1,81 @@
+package mantil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// LocalSecretProvider reads secrets and parameters from the environment
+// variables or JSON file, for tests and local development.
+//
+// Secret name is looked up in the MANTIL_SECRET_<NAME> and parameter in
+// the MANTIL_PARAM_<NAME> environment variable, where NAME is upper case
+// name with non alphanumeric characters replaced by underscore. Then in
+// the file from the MANTIL_SECRETS_FILE environment variable:
+//   {
+//     "secrets": {"db-password": "secret", "db": {"username": "admin"}},
+//     "params": {"api-url": "https://example.com"}
+//   }
+// Values which are not strings are returned as JSON.
+type LocalSecretProvider struct {
+	file string
+}
+
+// NewLocalSecretProvider creates provider which reads file from the
+// MANTIL_SECRETS_FILE environment variable.
+func NewLocalSecretProvider() *LocalSecretProvider {
+	return &LocalSecretProvider{file: os.Getenv(EnvSecretsFile)}
+}
+
+// Secret implements SecretProvider interface.
+func (p *LocalSecretProvider) Secret(name string) (string, error) {
+	return p.value("SECRET", "secrets", name)
+}
+
+// Param implements SecretProvider interface.
+func (p *LocalSecretProvider) Param(name string) (string, error) {
+	return p.value("PARAM", "params", name)
+}
+
+func (p *LocalSecretProvider) value(kind, section, name string) (string, error) {
+	if val, ok := os.LookupEnv(localSecretEnv(kind, name)); ok {
+		return val, nil
+	}
+	if p.file == "" {
+		return "", &ErrSecretNotFound{name: name}
+	}
+	buf, err := ioutil.ReadFile(p.file)
+	if err != nil {
+		return "", err
+	}
+	var content map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &content); err != nil {
+		return "", fmt.Errorf("failed to decode secrets file %s, %w", p.file, err)
+	}
+	raw, ok := content[section][name]
+	if !ok {
+		return "", &ErrSecretNotFound{name: name}
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	return string(raw), nil
+}
+
+// localSecretEnv returns name of the environment variable with the value.
+func localSecretEnv(kind, name string) string {
+	env := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	return "MANTIL_" + kind + "_" + env
+}
@@ -0,0 +1,79 @@
+package mantil
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalSecretProvider(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secrets.json")
+	err := ioutil.WriteFile(file, []byte(`{
+		"secrets": {"db-password": "from file", "db": {"username": "admin", "port": 5432}},
+		"params": {"api-url": "https://example.com"}
+	}`), 0644)
+	require.NoError(t, err)
+	t.Setenv(EnvSecretsFile, file)
+	t.Setenv("MANTIL_SECRET_API_KEY", "from env")
+	defer SetSecretProvider(nil)
+	SetSecretProvider(nil)
+
+	val, err := Secret("api-key")
+	require.NoError(t, err)
+	require.Equal(t, "from env", val)
+	val, err = Secret("db-password")
+	require.NoError(t, err)
+	require.Equal(t, "from file", val)
+	val, err = Param("api-url")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", val)
+
+	var db struct {
+		Username string `json:"username"`
+		Port     int    `json:"port"`
+	}
+	require.NoError(t, SecretJSON("db", &db))
+	require.Equal(t, "admin", db.Username)
+	require.Equal(t, 5432, db.Port)
+	require.Error(t, ParamJSON("api-url", &db))
+
+	_, err = Param("db-password")
+	var nf *ErrSecretNotFound
+	require.True(t, errors.As(err, &nf))
+}
+
+func TestLocalSecretEnv(t *testing.T) {
+	require.Equal(t, "MANTIL_SECRET_DB_PASSWORD", localSecretEnv("SECRET", "db-password"))
+	require.Equal(t, "MANTIL_PARAM_STRIPE_KEY_2", localSecretEnv("PARAM", "stripe.key/2"))
+}
+
+func TestAWSSecretProviderCache(t *testing.T) {
+	calls := 0
+	get := func() (string, error) {
+		calls++
+		return "value", nil
+	}
+	p := NewAWSSecretProvider(time.Minute)
+	for i := 0; i < 3; i++ {
+		val, err := p.cached("secret/name", get)
+		require.NoError(t, err)
+		require.Equal(t, "value", val)
+	}
+	require.Equal(t, 1, calls)
+
+	// expired
+	p.cache["secret/name"] = secretValue{value: "value", expires: time.Now().Add(-time.Second)}
+	_, err := p.cached("secret/name", get)
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+
+	// not cached without ttl
+	p = NewAWSSecretProvider(0)
+	_, _ = p.cached("secret/name", get)
+	_, _ = p.cached("secret/name", get)
+	require.Equal(t, 4, calls)
+}
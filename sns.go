@@ -0,0 +1,96 @@
+package mantil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	snssvc "github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+type sns struct {
+	client *snssvc.Client
+
+	mu sync.Mutex
+	// arns of the created topics
+	topics map[string]string
+}
+
+// newSNS returns SNS client shared in the process.
+func newSNS() (*sns, error) {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	if awsClients.sns != nil {
+		return awsClients.sns, nil
+	}
+	cfg, err := loadAWSConfig(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	s := &sns{
+		client: snssvc.NewFromConfig(cfg, func(o *snssvc.Options) {
+			if ep := awsEndpoint(EnvSNSEndpoint); ep != "" {
+				o.EndpointResolver = snssvc.EndpointResolverFromURL(ep)
+			}
+		}),
+	}
+	awsClients.sns = s
+	return s, nil
+}
+
+// SNSTopic creates a new SNS topic (if it doesn't already exist) for use
+// within a Mantil project. The final name of the topic follows the same
+// naming convention as other Mantil resources and can be found by calling
+// the Resource function.
+//
+// The topic will be deleted when the project stage is destroyed.
+//
+// Returns SNS client and the topic arn used in the client operations.
+// Please refer to the AWS SDK documentation for more information on how to use the client:
+// https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/service/sns#Client
+func SNSTopic(name string) (*snssvc.Client, string, error) {
+	s, err := newSNS()
+	if err != nil {
+		return nil, "", err
+	}
+	arn, err := s.createTopic(Resource(name).Name)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.client, arn, nil
+}
+
+// createTopic creates topic and returns its arn. Topic creation is
+// idempotent, for the existing topic it only returns arn.
+func (s *sns) createTopic(name string) (string, error) {
+	s.mu.Lock()
+	arn, ok := s.topics[name]
+	s.mu.Unlock()
+	if ok {
+		return arn, nil
+	}
+	var tags []types.Tag
+	for k, v := range config().ResourceTags {
+		tags = append(tags, types.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(v),
+		})
+	}
+	out, err := s.client.CreateTopic(context.Background(), &snssvc.CreateTopicInput{
+		Name: aws.String(name),
+		Tags: tags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not create topic %s - %w", name, err)
+	}
+	arn = aws.ToString(out.TopicArn)
+	s.mu.Lock()
+	if s.topics == nil {
+		s.topics = make(map[string]string)
+	}
+	s.topics[name] = arn
+	s.mu.Unlock()
+	return arn, nil
+}
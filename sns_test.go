@@ -0,0 +1,29 @@
+package mantil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	snssvc "github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSNSTopic(t *testing.T) {
+	name := "my-topic"
+	c, arn, err := SNSTopic(name)
+	require.NoError(t, err)
+	require.Contains(t, arn, Resource(name).Name)
+
+	tags, err := c.ListTagsForResource(context.Background(), &snssvc.ListTagsForResourceInput{
+		ResourceArn: aws.String(arn),
+	})
+	require.NoError(t, err)
+	require.Len(t, tags.Tags, len(config().ResourceTags))
+
+	// cleanup
+	_, err = c.DeleteTopic(context.Background(), &snssvc.DeleteTopicInput{
+		TopicArn: aws.String(arn),
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,264 @@
+package mantil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqssvc "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// suffix of the dead letter queue name
+const deadLetterQueueSuffix = "-dlq"
+
+// required suffix of the FIFO queue name
+const fifoQueueSuffix = ".fifo"
+
+// default number of receives before the message is moved to the dead letter queue
+const defaultMaxReceiveCount = 3
+
+type sqs struct {
+	client *sqssvc.Client
+
+	mu sync.Mutex
+	// urls of the verified queues
+	urls map[string]string
+}
+
+// newSQS returns SQS client shared in the process.
+func newSQS() (*sqs, error) {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	if awsClients.sqs != nil {
+		return awsClients.sqs, nil
+	}
+	cfg, err := loadAWSConfig(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	s := &sqs{
+		client: sqssvc.NewFromConfig(cfg, func(o *sqssvc.Options) {
+			if ep := awsEndpoint(EnvSQSEndpoint); ep != "" {
+				o.EndpointResolver = sqssvc.EndpointResolverFromURL(ep)
+			}
+		}),
+	}
+	awsClients.sqs = s
+	return s, nil
+}
+
+// QueueOptions describes SQS queue created by SQSQueueWithOptions.
+type QueueOptions struct {
+	// VisibilityTimeout is time in which received message is hidden from
+	// other consumers, should be longer than the consumer function timeout.
+	// SQS default is 30 seconds.
+	VisibilityTimeout time.Duration
+	// MessageRetention is time after which message is deleted from the
+	// queue. SQS default is 4 days.
+	MessageRetention time.Duration
+	// DeadLetterQueue creates dead letter queue named name-dlq. Messages
+	// which are not processed after MaxReceiveCount receives are moved to
+	// the dead letter queue.
+	DeadLetterQueue bool
+	// MaxReceiveCount, default 3.
+	MaxReceiveCount int
+	// FIFO creates first-in-first-out queue, the .fifo suffix is added to
+	// the queue name. Type of the existing queue can't be changed.
+	FIFO bool
+	// ContentBasedDeduplication uses hash of the message body as the
+	// deduplication id in the FIFO queue.
+	ContentBasedDeduplication bool
+}
+
+// queueName returns name of the queue with the FIFO suffix.
+func (o QueueOptions) queueName(name string) string {
+	if o.FIFO {
+		return name + fifoQueueSuffix
+	}
+	return name
+}
+
+func (o QueueOptions) maxReceiveCount() int {
+	if o.MaxReceiveCount <= 0 {
+		return defaultMaxReceiveCount
+	}
+	return o.MaxReceiveCount
+}
+
+// attributes returns queue attributes set by options.
+func (o QueueOptions) attributes(deadLetterArn string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	if o.VisibilityTimeout > 0 {
+		attrs[string(types.QueueAttributeNameVisibilityTimeout)] = strconv.Itoa(int(o.VisibilityTimeout / time.Second))
+	}
+	if o.MessageRetention > 0 {
+		attrs[string(types.QueueAttributeNameMessageRetentionPeriod)] = strconv.Itoa(int(o.MessageRetention / time.Second))
+	}
+	if deadLetterArn != "" {
+		policy, err := json.Marshal(map[string]string{
+			"deadLetterTargetArn": deadLetterArn,
+			"maxReceiveCount":     strconv.Itoa(o.maxReceiveCount()),
+		})
+		if err != nil {
+			return nil, err
+		}
+		attrs[string(types.QueueAttributeNameRedrivePolicy)] = string(policy)
+	}
+	if o.ContentBasedDeduplication {
+		attrs[string(types.QueueAttributeNameContentBasedDeduplication)] = "true"
+	}
+	return attrs, nil
+}
+
+// SQSQueue creates a new SQS queue (if it doesn't already exist) for use
+// within a Mantil project. The final name of the queue follows the same
+// naming convention as other Mantil resources and can be found by calling
+// the Resource function.
+//
+// The queue will be deleted when the project stage is destroyed.
+//
+// Returns SQS client and the queue url used in the client operations.
+// Please refer to the AWS SDK documentation for more information on how to use the client:
+// https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/service/sqs#Client
+func SQSQueue(name string) (*sqssvc.Client, string, error) {
+	return SQSQueueWithOptions(name, QueueOptions{})
+}
+
+// SQSQueueWithOptions creates a new SQS queue (if it doesn't already exist)
+// as SQSQueue with options for the visibility timeout, retention and dead
+// letter queue. Attributes of the existing queue are updated to the options.
+// Dead letter queue of the FIFO queue is also FIFO queue.
+// Example:
+//   client, url, err := mantil.SQSQueueWithOptions("jobs", mantil.QueueOptions{
+//   	VisibilityTimeout: 5 * time.Minute,
+//   	DeadLetterQueue:   true,
+//   })
+//
+func SQSQueueWithOptions(name string, opts QueueOptions) (*sqssvc.Client, string, error) {
+	s, err := newSQS()
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.ContentBasedDeduplication && !opts.FIFO {
+		return nil, "", fmt.Errorf("content based deduplication requires FIFO queue")
+	}
+	url, err := s.ensureQueue(Resource(name).Name, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.client, url, nil
+}
+
+// ensureQueue creates queue or updates attributes of the existing queue.
+// Queue is checked once per process for the same options.
+func (s *sqs) ensureQueue(name string, opts QueueOptions) (string, error) {
+	resource := fmt.Sprintf("%s/%v", name, opts)
+	s.mu.Lock()
+	url, ok := s.urls[resource]
+	s.mu.Unlock()
+	if ok {
+		return url, nil
+	}
+	url, err := s.queueURL(opts.queueName(name))
+	if err != nil {
+		return "", err
+	}
+	var deadLetterArn string
+	if opts.DeadLetterQueue {
+		dlq := opts.queueName(name + deadLetterQueueSuffix)
+		dlqURL, err := s.queueURL(dlq)
+		if err != nil {
+			return "", err
+		}
+		if dlqURL == "" {
+			if dlqURL, err = s.createQueue(dlq, opts.createAttributes(nil)); err != nil {
+				return "", err
+			}
+		}
+		if deadLetterArn, err = s.queueArn(dlqURL); err != nil {
+			return "", err
+		}
+	}
+	attrs, err := opts.attributes(deadLetterArn)
+	if err != nil {
+		return "", err
+	}
+	if url == "" {
+		url, err = s.createQueue(opts.queueName(name), opts.createAttributes(attrs))
+	} else if len(attrs) > 0 {
+		_, err = s.client.SetQueueAttributes(context.Background(), &sqssvc.SetQueueAttributesInput{
+			QueueUrl:   aws.String(url),
+			Attributes: attrs,
+		})
+		if err != nil {
+			err = fmt.Errorf("could not set attributes of queue %s - %w", name, err)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	if s.urls == nil {
+		s.urls = make(map[string]string)
+	}
+	s.urls[resource] = url
+	s.mu.Unlock()
+	return url, nil
+}
+
+// createAttributes adds attributes which can be set only on queue creation.
+func (o QueueOptions) createAttributes(attrs map[string]string) map[string]string {
+	if !o.FIFO {
+		return attrs
+	}
+	if attrs == nil {
+		attrs = make(map[string]string)
+	}
+	attrs[string(types.QueueAttributeNameFifoQueue)] = "true"
+	return attrs
+}
+
+// queueURL returns url of the queue, empty if the queue doesn't exist.
+func (s *sqs) queueURL(name string) (string, error) {
+	out, err := s.client.GetQueueUrl(context.Background(), &sqssvc.GetQueueUrlInput{
+		QueueName: aws.String(name),
+	})
+	if err != nil {
+		var qne *types.QueueDoesNotExist
+		if errors.As(err, &qne) {
+			return "", nil
+		}
+		return "", fmt.Errorf("error checking if queue %s exists - %w", name, err)
+	}
+	return aws.ToString(out.QueueUrl), nil
+}
+
+func (s *sqs) createQueue(name string, attrs map[string]string) (string, error) {
+	info("creating sqs queue %s", name)
+	out, err := s.client.CreateQueue(context.Background(), &sqssvc.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: attrs,
+		Tags:       config().ResourceTags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not create queue %s - %w", name, err)
+	}
+	return aws.ToString(out.QueueUrl), nil
+}
+
+func (s *sqs) queueArn(url string) (string, error) {
+	out, err := s.client.GetQueueAttributes(context.Background(), &sqssvc.GetQueueAttributesInput{
+		QueueUrl:       aws.String(url),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not get arn of queue %s - %w", url, err)
+	}
+	return out.Attributes[string(types.QueueAttributeNameQueueArn)], nil
+}
@@ -0,0 +1,72 @@
+package mantil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqssvc "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueOptionsAttributes(t *testing.T) {
+	attrs, err := QueueOptions{}.attributes("")
+	require.NoError(t, err)
+	require.Empty(t, attrs)
+
+	opts := QueueOptions{
+		VisibilityTimeout: 5 * time.Minute,
+		MessageRetention:  24 * time.Hour,
+		DeadLetterQueue:   true,
+	}
+	attrs, err = opts.attributes("arn:aws:sqs:eu-central-1:123456789012:jobs-dlq")
+	require.NoError(t, err)
+	require.Equal(t, "300", attrs["VisibilityTimeout"])
+	require.Equal(t, "86400", attrs["MessageRetentionPeriod"])
+	require.JSONEq(t, `{"deadLetterTargetArn":"arn:aws:sqs:eu-central-1:123456789012:jobs-dlq","maxReceiveCount":"3"}`, attrs["RedrivePolicy"])
+
+	opts.MaxReceiveCount = 10
+	attrs, err = opts.attributes("arn")
+	require.NoError(t, err)
+	require.Contains(t, attrs["RedrivePolicy"], `"maxReceiveCount":"10"`)
+}
+
+func TestSQSQueue(t *testing.T) {
+	name := "my-queue"
+	opts := QueueOptions{VisibilityTimeout: time.Minute, DeadLetterQueue: true}
+	c, url, err := SQSQueueWithOptions(name, opts)
+	require.NoError(t, err)
+	require.NotEmpty(t, url)
+
+	// existing queue is updated
+	opts.VisibilityTimeout = 2 * time.Minute
+	_, url2, err := SQSQueueWithOptions(name, opts)
+	require.NoError(t, err)
+	require.Equal(t, url, url2)
+
+	out, err := c.GetQueueAttributes(context.Background(), &sqssvc.GetQueueAttributesInput{
+		QueueUrl:       aws.String(url),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "120", out.Attributes["VisibilityTimeout"])
+	require.Contains(t, out.Attributes["RedrivePolicy"], Resource(name).Name+deadLetterQueueSuffix)
+
+	tags, err := c.ListQueueTags(context.Background(), &sqssvc.ListQueueTagsInput{
+		QueueUrl: aws.String(url),
+	})
+	require.NoError(t, err)
+	require.Len(t, tags.Tags, len(config().ResourceTags))
+
+	// cleanup
+	_, dlq, err := SQSQueue(name + deadLetterQueueSuffix)
+	require.NoError(t, err)
+	for _, u := range []string{url, dlq} {
+		_, err = c.DeleteQueue(context.Background(), &sqssvc.DeleteQueueInput{
+			QueueUrl: aws.String(u),
+		})
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,100 @@
+package mantil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ssmsvc "github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+type ssm struct {
+	client *ssmsvc.Client
+}
+
+// newSSM returns SSM client shared in the process.
+func newSSM() (*ssm, error) {
+	awsClients.Lock()
+	defer awsClients.Unlock()
+	if awsClients.ssm != nil {
+		return awsClients.ssm, nil
+	}
+	cfg, err := loadAWSConfig(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	s := &ssm{
+		client: ssmsvc.NewFromConfig(cfg, func(o *ssmsvc.Options) {
+			if ep := awsEndpoint(EnvSSMEndpoint); ep != "" {
+				o.EndpointResolver = ssmsvc.EndpointResolverFromURL(ep)
+			}
+		}),
+	}
+	awsClients.ssm = s
+	return s, nil
+}
+
+// SSMParameter creates a new SSM Parameter Store parameter (if it doesn't
+// already exist) for use within a Mantil project. The final name of the
+// parameter is the Mantil resource name, see Resource, prefixed with slash.
+//
+// New parameter is created as String with the initial value, which can't
+// be empty. Value of the existing parameter is not changed.
+//
+// The parameter will be deleted when the project stage is destroyed.
+//
+// Returns SSM client and the parameter name used in the client operations.
+// Please refer to the AWS SDK documentation for more information on how to use the client:
+// https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/service/ssm#Client
+func SSMParameter(name, value string) (*ssmsvc.Client, string, error) {
+	if value == "" {
+		return nil, "", fmt.Errorf("parameter %s initial value is required", name)
+	}
+	s, err := newSSM()
+	if err != nil {
+		return nil, "", err
+	}
+	pn := ssmParameterName(name)
+	if err := s.createParameter(pn, value); err != nil {
+		return nil, "", err
+	}
+	return s.client, pn, nil
+}
+
+func ssmParameterName(name string) string {
+	return "/" + Resource(name).Name
+}
+
+// createParameter creates parameter if it doesn't exist.
+// Parameter is checked once per process.
+func (s *ssm) createParameter(name, value string) error {
+	resource := "parameter" + name
+	if isVerified(resource) {
+		return nil
+	}
+	var tags []types.Tag
+	for k, v := range config().ResourceTags {
+		tags = append(tags, types.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(v),
+		})
+	}
+	_, err := s.client.PutParameter(context.Background(), &ssmsvc.PutParameterInput{
+		Name:  aws.String(name),
+		Value: aws.String(value),
+		Type:  types.ParameterTypeString,
+		Tags:  tags,
+	})
+	if err != nil {
+		var pae *types.ParameterAlreadyExists
+		if !errors.As(err, &pae) {
+			return fmt.Errorf("could not create parameter %s - %w", name, err)
+		}
+	} else {
+		info("created ssm parameter %s", name)
+	}
+	setVerified(resource)
+	return nil
+}
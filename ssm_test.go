@@ -0,0 +1,42 @@
+package mantil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ssmsvc "github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSMParameter(t *testing.T) {
+	_, _, err := SSMParameter("my-parameter", "")
+	require.Error(t, err)
+
+	c, name, err := SSMParameter("my-parameter", "initial")
+	require.NoError(t, err)
+	require.Equal(t, "/"+Resource("my-parameter").Name, name)
+
+	_, err = c.PutParameter(context.Background(), &ssmsvc.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String("changed"),
+		Overwrite: true,
+	})
+	require.NoError(t, err)
+
+	// existing value is not changed
+	resetAWSClients()
+	_, _, err = SSMParameter("my-parameter", "initial")
+	require.NoError(t, err)
+	out, err := c.GetParameter(context.Background(), &ssmsvc.GetParameterInput{
+		Name: aws.String(name),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "changed", aws.ToString(out.Parameter.Value))
+
+	// cleanup
+	_, err = c.DeleteParameter(context.Background(), &ssmsvc.DeleteParameterInput{
+		Name: aws.String(name),
+	})
+	require.NoError(t, err)
+}